@@ -0,0 +1,49 @@
+// Command matchbench runs batch matching over synthetic users scattered across
+// a square region and prints the resulting report, for comparing pairing
+// strategies and checking how matching scales with cohort size.
+//
+//	go run ./cmd/matchbench -users 100000 -strategy max_weight
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/uniqsocial/backend/internal/matcher"
+)
+
+func main() {
+	users := flag.Int("users", 100000, "number of synthetic users")
+	strategy := flag.String("strategy", matcher.StrategyGreedy, "pairing strategy: greedy or max_weight")
+	exactMax := flag.Int("exact-max-users", 1500, "largest cohort paired exactly under max_weight")
+	lat := flag.Float64("lat", 40, "latitude of the region centre")
+	lng := flag.Float64("lng", -95, "longitude of the region centre")
+	sizeKm := flag.Float64("size-km", 3000, "side length of the region in km")
+	radiusSteps := flag.String("radius-steps-km", "50,100,250", "comma-separated search radii tried in turn")
+	seed := flag.Int64("seed", 1, "random seed")
+	flag.Parse()
+
+	var steps []float64
+	for _, item := range strings.Split(*radiusSteps, ",") {
+		r, err := strconv.ParseFloat(strings.TrimSpace(item), 64)
+		if err != nil || r <= 0 {
+			log.Fatalf("invalid radius step %q", item)
+		}
+		if len(steps) > 0 && r <= steps[len(steps)-1] {
+			log.Fatalf("radius steps must increase, got %v after %v", r, steps[len(steps)-1])
+		}
+		steps = append(steps, r)
+	}
+
+	synthetic := matcher.SyntheticUsers(*users, *lat, *lng, *sizeKm, *seed)
+
+	report := matcher.SimulateBatch(matcher.Config{
+		Strategy:      *strategy,
+		ExactMaxUsers: *exactMax,
+		RadiusStepsKm: steps,
+	}, synthetic)
+	fmt.Println(report)
+}
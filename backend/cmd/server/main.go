@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -15,7 +16,9 @@ import (
 	"github.com/uniqsocial/backend/internal/auth"
 	"github.com/uniqsocial/backend/internal/chat"
 	"github.com/uniqsocial/backend/internal/db"
+	"github.com/uniqsocial/backend/internal/mail"
 	"github.com/uniqsocial/backend/internal/matcher"
+	"github.com/uniqsocial/backend/internal/notify"
 	"github.com/uniqsocial/backend/internal/profile"
 	"github.com/uniqsocial/backend/internal/scoring"
 	"github.com/uniqsocial/backend/internal/user"
@@ -24,6 +27,9 @@ import (
 
 func main() {
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
 	ctx := context.Background()
 
 	if err := db.RunMigrations(cfg.DatabaseURL, "migrations"); err != nil {
@@ -42,41 +48,96 @@ func main() {
 	}
 	defer rdb.Close()
 
-	jwtSvc := auth.NewJWTService(cfg.JWTSecret, cfg.JWTAccessTTL, cfg.JWTRefreshTTL)
-	authHandler := auth.NewHandler(pool, jwtSvc)
-	userHandler := user.NewHandler(pool)
+	jwtSvc, err := newJWTService(cfg)
+	if err != nil {
+		log.Fatalf("jwt: %v", err)
+	}
+	revocations := auth.NewRevocations(rdb, cfg.JWTAccessTTL)
+	loginLimiter := auth.NewLoginLimiter(rdb, auth.LoginLimits{
+		Window:        cfg.LoginWindow,
+		Lockout:       cfg.LoginLockout,
+		MaxFailures:   cfg.LoginMaxFailures,
+		MaxIPFailures: cfg.LoginMaxIPFailures,
+		DelayAfter:    cfg.LoginDelayAfter,
+		BaseDelay:     cfg.LoginBaseDelay,
+	})
+	authHandler := auth.NewHandler(pool, jwtSvc, revocations, loginLimiter, newMailer(cfg), cfg.AppURL, oidcProviders(cfg))
+	userHandler := user.NewHandler(pool, authHandler, cfg.AccountDeletionGrace)
+	purger := user.NewPurger(pool, cfg.AccountDeletionGrace)
+	go purger.Start(ctx)
 	scoringSvc := scoring.NewService(pool)
-	chatHub := chat.NewHub(pool, rdb, scoringSvc)
+	notifySvc := notify.NewService(pool, rdb, newNotifier(cfg))
+	go notifySvc.Start(ctx)
+	notifyHandler := notify.NewHandler(notifySvc)
+	chatHub := chat.NewHub(pool, rdb, scoringSvc, notifySvc)
 	go chatHub.Run()
-	chatHandler := chat.NewHandler(pool, rdb, chatHub, jwtSvc)
-	matcherSvc := matcher.NewService(pool, rdb)
+	wsTickets := auth.NewTicketStore(rdb, cfg.WSTicketTTL)
+	chatHandler := chat.NewHandler(pool, rdb, chatHub, jwtSvc, wsTickets)
+	matcherCfg, err := matcherConfig(cfg)
+	if err != nil {
+		log.Fatalf("matcher: %v", err)
+	}
+	matcherSvc := matcher.NewService(pool, rdb, scoringSvc, matcherCfg, matcher.Publishers{chatHub, notifySvc})
 	profileHandler := profile.NewHandler(pool)
 	matchHandler := matcher.NewHandler(matcherSvc)
 	scheduler := matcher.NewScheduler(matcherSvc, pool, scoringSvc)
 	go scheduler.Start(ctx)
 
 	r := chi.NewRouter()
+	if cfg.TrustProxy {
+		// Only behind a proxy that sets these headers; otherwise clients
+		// could spoof their IP to dodge per-IP login limits.
+		r.Use(middleware.RealIP)
+	}
+	r.Use(auth.RedactCredentials)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Heartbeat("/health"))
 	r.Use(corsMiddleware)
 
+	requireAuth := auth.Middleware(jwtSvc, revocations)
+
+	r.Get("/.well-known/jwks.json", authHandler.JWKS)
+
 	r.Route("/api", func(r chi.Router) {
 		r.Route("/auth", func(r chi.Router) {
 			r.Post("/signup", authHandler.Signup)
 			r.Post("/login", authHandler.Login)
 			r.Post("/refresh", authHandler.Refresh)
+			r.Post("/oidc/{provider}", authHandler.OIDCLogin)
+			r.Post("/oidc/{provider}/nonce", authHandler.OIDCNonce)
+			r.Post("/password/forgot", authHandler.ForgotPassword)
+			r.Post("/password/reset", authHandler.ResetPassword)
+			r.Post("/email/verify", authHandler.VerifyEmail)
+			r.With(requireAuth).Post("/email/resend", authHandler.ResendVerification)
+			r.Post("/2fa/login", authHandler.MFALogin)
+			r.With(requireAuth).Post("/2fa/setup", authHandler.SetupTOTP)
+			r.With(requireAuth).Post("/2fa/verify", authHandler.VerifyTOTP)
+			r.With(requireAuth).Post("/2fa/disable", authHandler.DisableTOTP)
+			r.With(requireAuth).Post("/logout", authHandler.Logout)
+			r.With(requireAuth).Post("/logout-all", authHandler.LogoutAll)
 		})
 
+		// WebSocket clients cannot send an Authorization header, so the
+		// handshake is authenticated separately.
+		r.With(auth.WebSocketMiddleware(jwtSvc, revocations, wsTickets)).Get("/chat/ws", chatHandler.WebSocket)
+
 		r.Group(func(r chi.Router) {
-			r.Use(auth.Middleware(jwtSvc))
+			r.Use(requireAuth)
 
 			r.Route("/users", func(r chi.Router) {
 				r.Get("/me", userHandler.GetMe)
 				r.Put("/me", userHandler.UpdateMe)
+				r.Delete("/me", userHandler.DeleteMe)
+				r.Get("/me/export", userHandler.Export)
 				r.Put("/me/location", userHandler.UpdateLocation)
 			})
 
+			r.Route("/devices", func(r chi.Router) {
+				r.Post("/", notifyHandler.RegisterDevice)
+				r.Delete("/{token}", notifyHandler.UnregisterDevice)
+			})
+
 			r.Route("/profile", func(r chi.Router) {
 				r.Get("/", profileHandler.Get)
 				r.Put("/", profileHandler.Update)
@@ -85,12 +146,20 @@ func main() {
 			r.Route("/match", func(r chi.Router) {
 				r.Get("/today", matchHandler.GetToday)
 				r.Post("/find", matchHandler.Find)
+				r.Post("/optin", matchHandler.OptIn)
+				r.Delete("/optin", matchHandler.OptOut)
+				r.Post("/skip", matchHandler.Skip)
+				r.Get("/preferences", matchHandler.GetPreferences)
+				r.Put("/preferences", matchHandler.UpdatePreferences)
 			})
 
 			r.Route("/chat", func(r chi.Router) {
-				r.Get("/ws", chatHandler.WebSocket)
+				r.Post("/ws-ticket", chatHandler.IssueTicket)
 				r.Get("/{sessionId}/messages", chatHandler.GetMessages)
 				r.Post("/{sessionId}/end", chatHandler.EndChat)
+				r.Post("/{sessionId}/feedback", chatHandler.SubmitFeedback)
+				r.Post("/{sessionId}/connect", chatHandler.Connect)
+				r.Get("/connections", chatHandler.GetConnections)
 			})
 		})
 	})
@@ -123,6 +192,122 @@ func main() {
 	log.Println("server stopped")
 }
 
+// newJWTService signs with JWT_PRIVATE_KEY_FILE when set, and with the HS256
+// JWT_SECRET otherwise. Keys listed in JWT_VERIFY_KEYS (and the secret, with
+// JWT_ACCEPT_HS256) stay valid for verification so rotating the signing key
+// does not log anyone out.
+func newJWTService(cfg *config.Config) (*auth.JWTService, error) {
+	hmacKey := auth.NewHMACKey("hs256", []byte(cfg.JWTSecret))
+
+	var verify []*auth.Key
+	for id, path := range cfg.JWTVerifyKeys {
+		key, err := auth.LoadKeyFile(id, path)
+		if err != nil {
+			return nil, err
+		}
+		verify = append(verify, key)
+	}
+
+	if cfg.JWTPrivateKeyFile == "" {
+		return auth.NewJWTService(hmacKey, verify, cfg.JWTAccessTTL, cfg.JWTRefreshTTL), nil
+	}
+
+	signing, err := auth.LoadKeyFile(cfg.JWTKeyID, cfg.JWTPrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if !signing.CanSign() {
+		return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE does not contain a private key")
+	}
+	if cfg.JWTAcceptHS256 {
+		verify = append(verify, hmacKey)
+	}
+	return auth.NewJWTService(signing, verify, cfg.JWTAccessTTL, cfg.JWTRefreshTTL), nil
+}
+
+// oidcProviders returns the identity providers that have client IDs configured.
+func oidcProviders(cfg *config.Config) []*auth.OIDCProvider {
+	var providers []*auth.OIDCProvider
+	if len(cfg.OIDCGoogleClientIDs) > 0 {
+		google := auth.NewOIDCProvider("google", cfg.OIDCGoogleIssuers, cfg.OIDCGoogleClientIDs)
+		google.RequireNonce = cfg.OIDCGoogleRequireNonce
+		providers = append(providers, google)
+	}
+	if len(cfg.OIDCAppleClientIDs) > 0 {
+		apple := auth.NewOIDCProvider("apple", cfg.OIDCAppleIssuers, cfg.OIDCAppleClientIDs)
+		apple.RequireNonce = cfg.OIDCAppleRequireNonce
+		providers = append(providers, apple)
+	}
+	return providers
+}
+
+// newMailer sends through SMTP when a relay is configured and otherwise logs
+// messages (or writes them to MAIL_DIR). Validate only allows the latter in
+// development.
+func newMailer(cfg *config.Config) mail.Mailer {
+	if cfg.SMTPHost != "" {
+		return mail.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	}
+	log.Println("mail: SMTP_HOST not set, logging outgoing mail")
+	return mail.NewLogMailer(cfg.MailDir)
+}
+
+// newNotifier pushes through Expo when PUSH_PROVIDER is "expo" and otherwise
+// logs notifications for local development.
+func newNotifier(cfg *config.Config) notify.Notifier {
+	if cfg.PushProvider == notify.ProviderExpo {
+		return notify.NewExpoNotifier(cfg.ExpoAccessToken)
+	}
+	log.Println("notify: PUSH_PROVIDER not set to expo, logging push notifications")
+	return notify.NewLogNotifier()
+}
+
+// matcherConfig builds the MATCH_RANKER strategy. MATCH_WEIGHTS and
+// MATCH_TRAIT_WEIGHTS override the matcher's default weights one key at a
+// time; keys they do not name keep their defaults, and unknown keys are an
+// error.
+func matcherConfig(cfg *config.Config) (matcher.Config, error) {
+	weights := matcher.DefaultPriorityWeights
+	for name, w := range cfg.MatchWeights {
+		switch name {
+		case "proximity":
+			weights.Proximity = w
+		case "engagement":
+			weights.Engagement = w
+		case "compatibility":
+			weights.Compatibility = w
+		case "reception":
+			weights.Reception = w
+		case "jitter":
+			weights.Jitter = w
+		default:
+			return matcher.Config{}, fmt.Errorf("MATCH_WEIGHTS: unknown signal %q", name)
+		}
+	}
+
+	traitWeights, err := matcher.TraitWeightsWith(cfg.MatchTraitWeights)
+	if err != nil {
+		return matcher.Config{}, fmt.Errorf("MATCH_TRAIT_WEIGHTS: %w", err)
+	}
+
+	ranker, err := matcher.NewRanker(cfg.MatchRanker, weights)
+	if err != nil {
+		return matcher.Config{}, err
+	}
+
+	return matcher.Config{
+		Strategy:            cfg.MatchStrategy,
+		ExactMaxUsers:       cfg.MatchExactMaxUsers,
+		RematchCooldownDays: cfg.MatchRematchCooldownDays,
+		RadiusStepsKm:       cfg.MatchRadiusStepsKm,
+		ActiveWindow:        cfg.MatchActiveWindow,
+		RevealDelay:         cfg.MatchRevealDelay,
+		SkipsPerDay:         cfg.MatchSkipsPerDay,
+		Ranker:              ranker,
+		Compatibility:       matcher.NewTraitScorer(traitWeights),
+	}, nil
+}
+
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"regexp"
 	"strings"
@@ -10,14 +11,23 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/uniqsocial/backend/internal/mail"
 	"github.com/uniqsocial/backend/pkg/response"
 )
 
 var emailRegex = regexp.MustCompile(`^[A-Za-z0-9+_.\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}$`)
 
 type Handler struct {
-	db     *pgxpool.Pool
-	jwtSvc *JWTService
+	db                 *pgxpool.Pool
+	jwtSvc             *JWTService
+	refreshTokens      *refreshStore
+	revocations        *Revocations
+	limiter            *LoginLimiter
+	passwordResets     *oneTimeTokens
+	emailVerifications *oneTimeTokens
+	mailer             mail.Mailer
+	appURL             string
+	providers          map[string]*OIDCProvider
 }
 
 type signupRequest struct {
@@ -35,8 +45,73 @@ type refreshRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-func NewHandler(db *pgxpool.Pool, jwtSvc *JWTService) *Handler {
-	return &Handler{db: db, jwtSvc: jwtSvc}
+type logoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// NewHandler creates the auth handler. appURL is the base URL of the client app
+// that links in emails point to.
+func NewHandler(db *pgxpool.Pool, jwtSvc *JWTService, revocations *Revocations, limiter *LoginLimiter, mailer mail.Mailer, appURL string, providers []*OIDCProvider) *Handler {
+	h := &Handler{
+		db:                 db,
+		jwtSvc:             jwtSvc,
+		refreshTokens:      newRefreshStore(db, jwtSvc.RefreshTTL()),
+		revocations:        revocations,
+		limiter:            limiter,
+		passwordResets:     newOneTimeTokens(db, "password_resets", passwordResetTTL),
+		emailVerifications: newOneTimeTokens(db, "email_verifications", emailVerificationTTL),
+		mailer:             mailer,
+		appURL:             strings.TrimRight(appURL, "/"),
+		providers:          make(map[string]*OIDCProvider),
+	}
+	for _, p := range providers {
+		h.providers[p.Name] = p
+	}
+	return h
+}
+
+// issueTokens starts or continues a refresh token family and returns a new
+// token pair for the user. An empty familyID starts a new family (a new login).
+func (h *Handler) issueTokens(ctx context.Context, userID, familyID string) (*TokenPair, error) {
+	var version int
+	if err := h.db.QueryRow(ctx,
+		`SELECT token_version FROM users WHERE id = $1`, userID).Scan(&version); err != nil {
+		return nil, err
+	}
+
+	if familyID == "" {
+		// Signing in again during the deletion grace period keeps the account
+		if _, err := h.db.Exec(ctx,
+			`UPDATE users SET deletion_requested_at = NULL
+			 WHERE id = $1 AND deletion_requested_at IS NOT NULL`, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	refreshID, familyID, err := h.refreshTokens.Create(ctx, userID, familyID)
+	if err != nil {
+		return nil, err
+	}
+	return h.jwtSvc.GenerateTokenPair(userID, refreshID, familyID, version)
+}
+
+// RevokeAllSessions bumps the user's token version and revokes every refresh
+// token, so no token issued before now keeps working on any device.
+func (h *Handler) RevokeAllSessions(ctx context.Context, userID string) error {
+	var version int
+	err := h.db.QueryRow(ctx,
+		`UPDATE users SET token_version = token_version + 1, updated_at = NOW()
+		 WHERE id = $1 RETURNING token_version`,
+		userID).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	if err := h.refreshTokens.RevokeUser(ctx, userID); err != nil {
+		return err
+	}
+
+	return h.revocations.SetTokenVersion(ctx, userID, version)
 }
 
 func (h *Handler) Signup(w http.ResponseWriter, r *http.Request) {
@@ -91,7 +166,10 @@ func (h *Handler) Signup(w http.ResponseWriter, r *http.Request) {
 	_, _ = h.db.Exec(context.Background(),
 		`INSERT INTO engagement_scores (user_id) VALUES ($1)`, userID)
 
-	tokens, err := h.jwtSvc.GenerateTokenPair(userID)
+	// The account is not matchable until the email is verified
+	go h.sendEmailVerification(userID, req.Email)
+
+	tokens, err := h.issueTokens(r.Context(), userID, "")
 	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "failed to generate tokens")
 		return
@@ -108,29 +186,33 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
+	ip := clientIP(r)
+
+	if wait := h.limiter.Check(r.Context(), req.Email, ip); wait > 0 {
+		response.TooManyRequests(w, wait, "too many login attempts, try again later")
+		return
+	}
 
 	var userID, passwordHash string
 	err := h.db.QueryRow(context.Background(),
-		`SELECT id, password_hash FROM users WHERE email = $1`, req.Email,
+		`SELECT id, COALESCE(password_hash, '') FROM users WHERE email = $1`, req.Email,
 	).Scan(&userID, &passwordHash)
 
 	if err != nil {
+		h.limiter.RecordFailure(r.Context(), req.Email, ip)
 		response.Error(w, http.StatusUnauthorized, "invalid email or password")
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		h.limiter.RecordFailure(r.Context(), req.Email, ip)
 		response.Error(w, http.StatusUnauthorized, "invalid email or password")
 		return
 	}
 
-	tokens, err := h.jwtSvc.GenerateTokenPair(userID)
-	if err != nil {
-		response.Error(w, http.StatusInternalServerError, "failed to generate tokens")
-		return
-	}
+	h.limiter.Reset(r.Context(), req.Email)
 
-	response.JSON(w, http.StatusOK, tokens)
+	h.completeLogin(w, r, userID, http.StatusOK)
 }
 
 func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
@@ -151,7 +233,17 @@ func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokens, err := h.jwtSvc.GenerateTokenPair(claims.UserID)
+	userID, familyID, err := h.refreshTokens.Rotate(r.Context(), claims.ID)
+	if err != nil {
+		if errors.Is(err, errRefreshReused) {
+			response.Error(w, http.StatusUnauthorized, "refresh token reuse detected")
+			return
+		}
+		response.Error(w, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+
+	tokens, err := h.issueTokens(r.Context(), userID, familyID)
 	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "failed to generate tokens")
 		return
@@ -159,3 +251,57 @@ func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 
 	response.JSON(w, http.StatusOK, tokens)
 }
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaims(r.Context())
+
+	var req logoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.Error(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	// The access token names its login's refresh token family, so the
+	// refresh token is only needed for tokens issued without one.
+	familyID := claims.Family
+	if familyID == "" && req.RefreshToken != "" {
+		refresh, err := h.jwtSvc.ValidateToken(req.RefreshToken)
+		if err != nil || refresh.Type != "refresh" || refresh.UserID != claims.UserID {
+			response.Error(w, http.StatusBadRequest, "invalid refresh token")
+			return
+		}
+
+		familyID, err = h.refreshTokens.Family(r.Context(), refresh.ID)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "failed to revoke refresh token")
+			return
+		}
+	}
+
+	if familyID != "" {
+		if err := h.refreshTokens.RevokeFamily(r.Context(), familyID); err != nil {
+			response.Error(w, http.StatusInternalServerError, "failed to revoke refresh token")
+			return
+		}
+	}
+
+	if err := h.revocations.RevokeAccessToken(r.Context(), claims); err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to revoke access token")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"status": "logged_out"})
+}
+
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserID(r.Context())
+
+	if err := h.RevokeAllSessions(r.Context(), userID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to revoke sessions")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"status": "logged_out"})
+}
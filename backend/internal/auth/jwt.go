@@ -2,13 +2,19 @@ package auth
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// JWTService signs tokens with one key and verifies them against every key in
+// its set, so a retired signing key keeps validating the tokens it issued until
+// they expire.
 type JWTService struct {
-	secret     []byte
+	signing    *Key
+	keys       map[string]*Key
+	legacy     *Key // HMAC key for tokens issued before kid headers existed
 	accessTTL  time.Duration
 	refreshTTL time.Duration
 }
@@ -19,26 +25,46 @@ type TokenPair struct {
 }
 
 type Claims struct {
-	UserID string `json:"user_id"`
-	Type   string `json:"type"` // "access" or "refresh"
+	UserID  string `json:"user_id"`
+	Type    string `json:"type"` // "access", "refresh" or "mfa"
+	Version int    `json:"ver"`  // users.token_version at issue time
+	// Family is the refresh token family of the login an access token
+	// belongs to, so logout can revoke it.
+	Family string `json:"fam,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func NewJWTService(secret string, accessTTL, refreshTTL time.Duration) *JWTService {
-	return &JWTService{
-		secret:     []byte(secret),
+func NewJWTService(signing *Key, verify []*Key, accessTTL, refreshTTL time.Duration) *JWTService {
+	s := &JWTService{
+		signing:    signing,
+		keys:       make(map[string]*Key),
 		accessTTL:  accessTTL,
 		refreshTTL: refreshTTL,
 	}
+	for _, k := range append([]*Key{signing}, verify...) {
+		s.keys[k.ID] = k
+		if s.legacy == nil && k.symmetric() {
+			s.legacy = k
+		}
+	}
+	return s
 }
 
-func (s *JWTService) GenerateTokenPair(userID string) (*TokenPair, error) {
-	access, err := s.generateToken(userID, "access", s.accessTTL)
+// GenerateTokenPair issues an access token and a refresh token whose jti is
+// refreshID, the id of the row tracking it in refresh_tokens. Both carry the
+// user's current token version, and the access token carries familyID.
+func (s *JWTService) GenerateTokenPair(userID, refreshID, familyID string, version int) (*TokenPair, error) {
+	accessID, err := randomToken(16)
 	if err != nil {
 		return nil, err
 	}
 
-	refresh, err := s.generateToken(userID, "refresh", s.refreshTTL)
+	access, err := s.generateToken(userID, accessID, "access", familyID, version, s.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := s.generateToken(userID, refreshID, "refresh", "", version, s.refreshTTL)
 	if err != nil {
 		return nil, err
 	}
@@ -51,10 +77,18 @@ func (s *JWTService) GenerateTokenPair(userID string) (*TokenPair, error) {
 
 func (s *JWTService) ValidateToken(tokenStr string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		key := s.legacy
+		if kid, ok := t.Header["kid"].(string); ok {
+			key = s.keys[kid]
+		}
+		if key == nil {
+			return nil, fmt.Errorf("unknown signing key: %v", t.Header["kid"])
+		}
+		// The key, not the token, decides the algorithm
+		if t.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
-		return s.secret, nil
+		return key.public, nil
 	})
 	if err != nil {
 		return nil, err
@@ -68,17 +102,48 @@ func (s *JWTService) ValidateToken(tokenStr string) (*Claims, error) {
 	return claims, nil
 }
 
-func (s *JWTService) generateToken(userID, tokenType string, ttl time.Duration) (string, error) {
+// GenerateMFAToken issues a short-lived token that proves the first login
+// factor and can only be exchanged for a token pair at the 2FA login endpoint.
+func (s *JWTService) GenerateMFAToken(userID string, ttl time.Duration) (string, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	return s.generateToken(userID, id, "mfa", "", 0, ttl)
+}
+
+// RefreshTTL returns the lifetime of refresh tokens.
+func (s *JWTService) RefreshTTL() time.Duration {
+	return s.refreshTTL
+}
+
+func (s *JWTService) generateToken(userID, tokenID, tokenType, familyID string, version int, ttl time.Duration) (string, error) {
 	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
-		Type:   tokenType,
+		UserID:  userID,
+		Type:    tokenType,
+		Version: version,
+		Family:  familyID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secret)
+	token := jwt.NewWithClaims(s.signing.Method, claims)
+	token.Header["kid"] = s.signing.ID
+	return token.SignedString(s.signing.private)
+}
+
+// JWKS returns the public halves of all asymmetric keys.
+func (s *JWTService) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range s.keys {
+		if jwk, ok := k.jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
 }
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginLimits configures LoginLimiter.
+type LoginLimits struct {
+	Window        time.Duration // how far back failures are counted
+	Lockout       time.Duration // how long a subject is locked out
+	MaxFailures   int           // failures per email before lockout
+	MaxIPFailures int           // failures per client IP before lockout
+	DelayAfter    int           // failures per email before delays start
+	BaseDelay     time.Duration // first delay, doubled on each further failure
+}
+
+// LoginLimiter throttles failed logins per email and per client IP with
+// sliding windows kept in Redis sorted sets. Repeated failures first impose
+// growing delays between attempts, then a temporary lockout.
+type LoginLimiter struct {
+	rdb    *redis.Client
+	limits LoginLimits
+}
+
+func NewLoginLimiter(rdb *redis.Client, limits LoginLimits) *LoginLimiter {
+	return &LoginLimiter{rdb: rdb, limits: limits}
+}
+
+func failuresKey(kind, subject string) string {
+	return fmt.Sprintf("login:fail:%s:%s", kind, subject)
+}
+
+func lockoutKey(kind, subject string) string {
+	return fmt.Sprintf("login:lock:%s:%s", kind, subject)
+}
+
+// Check returns how long the caller must wait before the next attempt, or zero
+// if an attempt is allowed now.
+func (l *LoginLimiter) Check(ctx context.Context, email, ip string) time.Duration {
+	var wait time.Duration
+	for _, subject := range [][2]string{{"email", email}, {"ip", ip}} {
+		if ttl := l.rdb.PTTL(ctx, lockoutKey(subject[0], subject[1])).Val(); ttl > wait {
+			wait = ttl
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	now := time.Now()
+	key := failuresKey("email", email)
+	l.rdb.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Add(-l.limits.Window).UnixMilli(), 10))
+
+	failures := int(l.rdb.ZCard(ctx, key).Val())
+	if failures < l.limits.DelayAfter {
+		return 0
+	}
+
+	last, err := l.rdb.ZRangeWithScores(ctx, key, -1, -1).Result()
+	if err != nil || len(last) == 0 {
+		return 0
+	}
+
+	delay := time.Duration(float64(l.limits.BaseDelay) * math.Pow(2, float64(failures-l.limits.DelayAfter)))
+	if delay > l.limits.Lockout {
+		delay = l.limits.Lockout
+	}
+	lastAt := time.UnixMilli(int64(last[0].Score))
+	return time.Until(lastAt.Add(delay))
+}
+
+// RecordFailure counts a failed attempt and locks out the email or IP once it
+// crosses its limit.
+func (l *LoginLimiter) RecordFailure(ctx context.Context, email, ip string) {
+	now := time.Now()
+	subjects := []struct {
+		kind, subject string
+		max           int
+	}{
+		{"email", email, l.limits.MaxFailures},
+		{"ip", ip, l.limits.MaxIPFailures},
+	}
+
+	for _, s := range subjects {
+		key := failuresKey(s.kind, s.subject)
+		pipe := l.rdb.TxPipeline()
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Add(-l.limits.Window).UnixMilli(), 10))
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixMilli()), Member: now.UnixNano()})
+		count := pipe.ZCard(ctx, key)
+		pipe.Expire(ctx, key, l.limits.Window)
+		if _, err := pipe.Exec(ctx); err != nil {
+			continue
+		}
+
+		if int(count.Val()) >= s.max {
+			l.rdb.Set(ctx, lockoutKey(s.kind, s.subject), 1, l.limits.Lockout)
+			l.rdb.Del(ctx, key)
+		}
+	}
+}
+
+// Reset clears the failure history of an email after a successful login.
+func (l *LoginLimiter) Reset(ctx context.Context, email string) {
+	l.rdb.Del(ctx, failuresKey("email", email))
+}
+
+// clientIP returns the host part of the request's remote address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
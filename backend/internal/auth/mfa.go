@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/uniqsocial/backend/pkg/response"
+)
+
+const (
+	mfaTokenTTL       = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type mfaLoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// mfaChallenge is returned by login instead of a TokenPair when the account
+// has two-factor authentication enabled.
+type mfaChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// completeLogin finishes a successful first-factor login: it returns a token
+// pair, or an mfa_required challenge when the user has 2FA enabled.
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request, userID string, status int) {
+	var enabled bool
+	err := h.db.QueryRow(r.Context(),
+		`SELECT totp_enabled_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&enabled)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+
+	if enabled {
+		token, err := h.jwtSvc.GenerateMFAToken(userID, mfaTokenTTL)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "failed to generate tokens")
+			return
+		}
+		response.JSON(w, http.StatusOK, mfaChallenge{MFARequired: true, MFAToken: token})
+		return
+	}
+
+	tokens, err := h.issueTokens(r.Context(), userID, "")
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to generate tokens")
+		return
+	}
+
+	response.JSON(w, status, tokens)
+}
+
+// SetupTOTP generates a new TOTP secret for the current user. 2FA is not
+// enabled until a code from it is confirmed through VerifyTOTP.
+func (h *Handler) SetupTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserID(r.Context())
+
+	var email string
+	var enabled bool
+	err := h.db.QueryRow(r.Context(),
+		`SELECT email, totp_enabled_at IS NOT NULL FROM users WHERE id = $1`,
+		userID).Scan(&email, &enabled)
+	if err != nil {
+		response.Error(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if enabled {
+		response.Error(w, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to generate secret")
+		return
+	}
+
+	_, err = h.db.Exec(r.Context(),
+		`UPDATE users SET totp_secret = $1, totp_last_step = NULL, updated_at = NOW() WHERE id = $2`,
+		secret, userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to save secret")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{
+		"secret":      secret,
+		"otpauth_url": totpURL(secret, email),
+	})
+}
+
+// VerifyTOTP enables 2FA once the user proves their authenticator works, and
+// returns a fresh set of recovery codes. They are shown only this once.
+func (h *Handler) VerifyTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserID(r.Context())
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var secret *string
+	var enabled bool
+	err := h.db.QueryRow(r.Context(),
+		`SELECT totp_secret, totp_enabled_at IS NOT NULL FROM users WHERE id = $1`,
+		userID).Scan(&secret, &enabled)
+	if err != nil || secret == nil {
+		response.Error(w, http.StatusBadRequest, "two-factor setup has not been started")
+		return
+	}
+
+	if enabled {
+		response.Error(w, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	step, ok := validateTOTP(*secret, normalizeCode(req.Code), time.Now())
+	if !ok {
+		response.Error(w, http.StatusBadRequest, "invalid code")
+		return
+	}
+
+	codes, err := h.enableTOTP(r.Context(), userID, step)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to enable two-factor authentication")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":        true,
+		"recovery_codes": codes,
+	})
+}
+
+func (h *Handler) enableTOTP(ctx context.Context, userID string, step int64) ([]string, error) {
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $1, updated_at = NOW() WHERE id = $2`,
+		step, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw, err := randomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = raw[:5] + "-" + raw[5:]
+		_, err = tx.Exec(ctx,
+			`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, hashToken(normalizeCode(codes[i])))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, tx.Commit(ctx)
+}
+
+// DisableTOTP turns 2FA off after checking a current code or a recovery code.
+func (h *Handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserID(r.Context())
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// Guessing a code here would turn 2FA off, so it is throttled like login
+	subject := "mfa:" + userID
+	ip := clientIP(r)
+	if wait := h.limiter.Check(r.Context(), subject, ip); wait > 0 {
+		response.TooManyRequests(w, wait, "too many attempts, try again later")
+		return
+	}
+
+	if !h.checkSecondFactor(r.Context(), userID, req.Code) {
+		h.limiter.RecordFailure(r.Context(), subject, ip)
+		response.Error(w, http.StatusBadRequest, "invalid code")
+		return
+	}
+	h.limiter.Reset(r.Context(), subject)
+
+	_, err := h.db.Exec(r.Context(),
+		`UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
+		 WHERE id = $1`,
+		userID)
+	if err == nil {
+		_, err = h.db.Exec(r.Context(), `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to disable two-factor authentication")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]bool{"enabled": false})
+}
+
+// MFALogin exchanges the token from an mfa_required login plus a TOTP or
+// recovery code for a token pair. Each token can be exchanged only once.
+func (h *Handler) MFALogin(w http.ResponseWriter, r *http.Request) {
+	var req mfaLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	claims, err := h.jwtSvc.ValidateToken(req.MFAToken)
+	if err != nil || claims.Type != "mfa" || h.revocations.IsSpent(r.Context(), claims) {
+		response.Error(w, http.StatusUnauthorized, "invalid or expired mfa token")
+		return
+	}
+
+	// Codes are short, so they get the same throttling as passwords
+	subject := "mfa:" + claims.UserID
+	ip := clientIP(r)
+	if wait := h.limiter.Check(r.Context(), subject, ip); wait > 0 {
+		response.TooManyRequests(w, wait, "too many attempts, try again later")
+		return
+	}
+
+	if !h.checkSecondFactor(r.Context(), claims.UserID, req.Code) {
+		h.limiter.RecordFailure(r.Context(), subject, ip)
+		response.Error(w, http.StatusUnauthorized, "invalid code")
+		return
+	}
+	h.limiter.Reset(r.Context(), subject)
+
+	// The token is single-use; of two concurrent exchanges only one succeeds
+	if spent, err := h.revocations.SpendToken(r.Context(), claims); err != nil || !spent {
+		response.Error(w, http.StatusUnauthorized, "invalid or expired mfa token")
+		return
+	}
+
+	tokens, err := h.issueTokens(r.Context(), claims.UserID, "")
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to generate tokens")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, tokens)
+}
+
+// checkSecondFactor accepts either a TOTP code, which may not be reused, or an
+// unused recovery code, which is spent.
+func (h *Handler) checkSecondFactor(ctx context.Context, userID, code string) bool {
+	code = normalizeCode(code)
+	if code == "" {
+		return false
+	}
+
+	var secret *string
+	err := h.db.QueryRow(ctx,
+		`SELECT totp_secret FROM users WHERE id = $1 AND totp_enabled_at IS NOT NULL`,
+		userID).Scan(&secret)
+	if err != nil || secret == nil {
+		return false
+	}
+
+	if step, ok := validateTOTP(*secret, code, time.Now()); ok {
+		tag, err := h.db.Exec(ctx,
+			`UPDATE users SET totp_last_step = $1
+			 WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`,
+			step, userID)
+		return err == nil && tag.RowsAffected() == 1
+	}
+
+	tag, err := h.db.Exec(ctx,
+		`UPDATE recovery_codes SET used_at = NOW()
+		 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, hashToken(code))
+	return err == nil && tag.RowsAffected() > 0
+}
+
+// normalizeCode strips the separators users tend to type into codes.
+func normalizeCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -10,9 +10,12 @@ import (
 
 type contextKey string
 
-const UserIDKey contextKey = "user_id"
+const (
+	UserIDKey contextKey = "user_id"
+	ClaimsKey contextKey = "claims"
+)
 
-func Middleware(jwtSvc *JWTService) func(http.Handler) http.Handler {
+func Middleware(jwtSvc *JWTService, revocations *Revocations) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			header := r.Header.Get("Authorization")
@@ -27,26 +30,49 @@ func Middleware(jwtSvc *JWTService) func(http.Handler) http.Handler {
 				return
 			}
 
-			claims, err := jwtSvc.ValidateToken(parts[1])
-			if err != nil {
-				response.Error(w, http.StatusUnauthorized, "invalid or expired token")
-				return
-			}
-
-			if claims.Type != "access" {
-				response.Error(w, http.StatusUnauthorized, "invalid token type")
+			claims, status, msg := authenticate(r.Context(), jwtSvc, revocations, parts[1])
+			if claims == nil {
+				response.Error(w, status, msg)
 				return
 			}
 
 			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+			ctx = context.WithValue(ctx, ClaimsKey, claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// authenticate validates an access token and returns its claims, or the status
+// and message to reply with when the token is rejected.
+func authenticate(ctx context.Context, jwtSvc *JWTService, revocations *Revocations, token string) (*Claims, int, string) {
+	claims, err := jwtSvc.ValidateToken(token)
+	if err != nil {
+		return nil, http.StatusUnauthorized, "invalid or expired token"
+	}
+
+	if claims.Type != "access" {
+		return nil, http.StatusUnauthorized, "invalid token type"
+	}
+
+	if revocations.IsRevoked(ctx, claims) {
+		return nil, http.StatusUnauthorized, "token has been revoked"
+	}
+
+	return claims, 0, ""
+}
+
 func GetUserID(ctx context.Context) string {
 	if v, ok := ctx.Value(UserIDKey).(string); ok {
 		return v
 	}
 	return ""
 }
+
+// GetClaims returns the access token claims of the authenticated request.
+func GetClaims(ctx context.Context) *Claims {
+	if v, ok := ctx.Value(ClaimsKey).(*Claims); ok {
+		return v
+	}
+	return nil
+}
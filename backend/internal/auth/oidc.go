@@ -0,0 +1,383 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/uniqsocial/backend/pkg/response"
+)
+
+// jwksRefreshInterval throttles JWKS refetches triggered by unknown kids.
+const jwksRefreshInterval = time.Minute
+
+// idTokenLeeway is the clock skew allowed when checking ID token expiry.
+const idTokenLeeway = time.Minute
+
+// oidcNonceTTL is how long a client has to finish a sign-in it started with
+// a nonce from OIDCNonce.
+const oidcNonceTTL = 10 * time.Minute
+
+// OIDCProvider verifies ID tokens from an OpenID Connect issuer such as Google
+// or Apple. Signing keys are discovered through the first issuer's
+// /.well-known/openid-configuration and cached until a token names a kid that
+// is not in the cache.
+type OIDCProvider struct {
+	Name string
+	// RequireNonce refuses ID tokens without a nonce. Google's native SDKs
+	// do not always send one.
+	RequireNonce bool
+
+	issuers   []string
+	clientIDs []string
+	client    *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*Key
+	fetchedAt time.Time
+}
+
+// IDTokenClaims are the ID token claims used to sign a user in.
+type IDTokenClaims struct {
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+	Nonce         string   `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// flexBool accepts both JSON booleans and the "true"/"false" strings Apple
+// sends for email_verified.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	*b = flexBool(s == "true")
+	return nil
+}
+
+// NewOIDCProvider returns a provider accepting ID tokens from any of issuers,
+// such as Google's "https://accounts.google.com" and "accounts.google.com".
+// The first must be a URL; it is used for discovery.
+func NewOIDCProvider(name string, issuers, clientIDs []string) *OIDCProvider {
+	trimmed := make([]string, len(issuers))
+	for i, iss := range issuers {
+		trimmed[i] = strings.TrimRight(iss, "/")
+	}
+	return &OIDCProvider{
+		Name:      name,
+		issuers:   trimmed,
+		clientIDs: clientIDs,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		keys:      make(map[string]*Key),
+	}
+}
+
+// Verify checks an ID token's signature, issuer, audience and expiry.
+func (p *OIDCProvider) Verify(ctx context.Context, rawToken string) (*IDTokenClaims, error) {
+	token, err := jwt.ParseWithClaims(rawToken, &IDTokenClaims{}, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := p.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return key.public, nil
+	},
+		jwt.WithAudience(p.clientIDs...),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(idTokenLeeway),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*IDTokenClaims)
+	if !ok || !token.Valid || claims.Subject == "" {
+		return nil, fmt.Errorf("invalid id token")
+	}
+	if !slices.Contains(p.issuers, claims.Issuer) {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	return claims, nil
+}
+
+// key returns the issuer's signing key with the given kid, refetching the key
+// set when the kid is unknown. The lock is not held while fetching, so a slow
+// issuer does not hold up tokens whose keys are cached.
+func (p *OIDCProvider) key(ctx context.Context, kid string) (*Key, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	refetch := !ok && time.Since(p.fetchedAt) >= jwksRefreshInterval
+	if refetch {
+		// Claimed before fetching, so concurrent lookups do not fetch too
+		p.fetchedAt = time.Now()
+	}
+	p.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+	if !refetch {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *OIDCProvider) fetchKeys(ctx context.Context) (map[string]*Key, error) {
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := p.getJSON(ctx, p.issuers[0]+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery: no jwks_uri")
+	}
+
+	var set JWKSet
+	if err := p.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+
+	keys := make(map[string]*Key)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.Key()
+		if err != nil {
+			continue // Skip key types we cannot verify with
+		}
+		keys[key.ID] = key
+	}
+	return keys, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type oidcLoginRequest struct {
+	IDToken string `json:"id_token"`
+}
+
+// OIDCNonce issues a nonce for the client to start a sign-in with the provider
+// named in the URL. The ID token that comes back must carry it, which ties
+// the token to a sign-in this server started.
+func (h *Handler) OIDCNonce(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		response.Error(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+
+	nonce, err := h.revocations.IssueNonce(r.Context(), provider.Name, oidcNonceTTL)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to issue nonce")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"nonce":      nonce,
+		"expires_in": int(oidcNonceTTL.Seconds()),
+	})
+}
+
+// OIDCLogin signs a user in with an ID token from the provider named in the
+// URL, creating the account on first use.
+func (h *Handler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		response.Error(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+
+	var req oidcLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	claims, err := provider.Verify(r.Context(), req.IDToken)
+	if err != nil {
+		response.Error(w, http.StatusUnauthorized, "invalid id token")
+		return
+	}
+
+	// A nonce must be one this server issued, and is redeemed once. A token
+	// without one is not tied to a sign-in we started; it only signs in once,
+	// so a leaked token cannot be replayed after its first use.
+	switch {
+	case claims.Nonce != "":
+		if ok, err := h.revocations.RedeemNonce(r.Context(), provider.Name, claims.Nonce); err != nil || !ok {
+			response.Error(w, http.StatusUnauthorized, "invalid or expired nonce")
+			return
+		}
+	case provider.RequireNonce:
+		response.Error(w, http.StatusUnauthorized, "id token has no nonce")
+		return
+	default:
+		if spent, err := h.revocations.SpendIDToken(r.Context(), provider.Name, req.IDToken, claims.ExpiresAt.Add(idTokenLeeway)); err != nil || !spent {
+			response.Error(w, http.StatusUnauthorized, "id token already used")
+			return
+		}
+	}
+
+	userID, created, err := h.linkIdentity(r.Context(), provider.Name, claims)
+	if err != nil {
+		if errors.Is(err, errIdentityConflict) {
+			response.Error(w, http.StatusConflict, "an account with this email already exists; sign in with your password first")
+			return
+		}
+		response.Error(w, http.StatusInternalServerError, "failed to sign in")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	h.completeLogin(w, r, userID, status)
+}
+
+var errIdentityConflict = errors.New("email belongs to another account")
+
+// linkIdentity returns the user behind a provider identity. An unknown identity
+// is linked to the account with the same email when the provider has verified
+// that email, and otherwise gets a new passwordless account.
+func (h *Handler) linkIdentity(ctx context.Context, provider string, claims *IDTokenClaims) (string, bool, error) {
+	userID, err := h.identityUser(ctx, provider, claims.Subject)
+	if err == nil {
+		return userID, false, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", false, err
+	}
+
+	email := strings.TrimSpace(strings.ToLower(claims.Email))
+	if email == "" {
+		return "", false, fmt.Errorf("identity provider returned no email")
+	}
+	verified := bool(claims.EmailVerified)
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// lostRace returns the user a concurrent first login with the same
+	// identity linked while this one was in progress
+	lostRace := func() (string, bool, error) {
+		tx.Rollback(ctx)
+		userID, err := h.identityUser(ctx, provider, claims.Subject)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, errIdentityConflict
+		}
+		return userID, false, err
+	}
+
+	created := false
+	err = tx.QueryRow(ctx, `SELECT id FROM users WHERE email = $1`, email).Scan(&userID)
+	switch {
+	case err == nil:
+		// Linking on an unverified email would let anyone who can register
+		// that address with the provider take over the account.
+		if !verified {
+			return "", false, errIdentityConflict
+		}
+		_, err = tx.Exec(ctx,
+			`UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+			 WHERE id = $1`, userID)
+	case errors.Is(err, pgx.ErrNoRows):
+		username := strings.TrimSpace(claims.Name)
+		if username == "" {
+			username, _, _ = strings.Cut(email, "@")
+		}
+		err = tx.QueryRow(ctx,
+			`INSERT INTO users (email, username, email_verified_at)
+			 VALUES ($1, $2, CASE WHEN $3 THEN NOW() END)
+			 ON CONFLICT (email) DO NOTHING
+			 RETURNING id`,
+			email, username, verified).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return lostRace()
+		}
+		if err == nil {
+			_, err = tx.Exec(ctx, `INSERT INTO engagement_scores (user_id) VALUES ($1)`, userID)
+		}
+		created = true
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO user_identities (provider, subject, user_id, email) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (provider, subject) DO NOTHING`,
+		provider, claims.Subject, userID, email)
+	if err != nil {
+		return "", false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return lostRace()
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", false, err
+	}
+
+	if created && !verified {
+		go h.sendEmailVerification(userID, email)
+	}
+	return userID, created, nil
+}
+
+// identityUser returns the user linked to a provider identity.
+func (h *Handler) identityUser(ctx context.Context, provider, subject string) (string, error) {
+	var userID string
+	err := h.db.QueryRow(ctx,
+		`SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2`,
+		provider, subject).Scan(&userID)
+	return userID, err
+}
@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/uniqsocial/backend/internal/db/dbtest"
+)
+
+// fakeIssuer is a local OpenID Connect issuer serving discovery and a JWKS
+// with one RSA signing key.
+type fakeIssuer struct {
+	*httptest.Server
+	key       *Key
+	jwksHits  atomic.Int32
+	clientIDs []string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	iss := &fakeIssuer{key: newRSAKey(t, "issuer-key"), clientIDs: []string{"web-client", "ios-client"}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   iss.URL,
+			"jwks_uri": iss.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		iss.jwksHits.Add(1)
+		jwk, _ := iss.key.jwk()
+		json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{jwk}})
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+func newRSAKey(t *testing.T, id string) *Key {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return &Key{ID: id, Method: jwt.SigningMethodRS256, private: private, public: &private.PublicKey}
+}
+
+// idToken signs claims with key, naming it in the kid header.
+func idToken(t *testing.T, key *Key, claims IDTokenClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.private)
+	if err != nil {
+		t.Fatalf("sign id token: %v", err)
+	}
+	return signed
+}
+
+func TestOIDCProviderVerify(t *testing.T) {
+	iss := newFakeIssuer(t)
+	// Like Google, the issuer also signs tokens naming it without a scheme
+	bareIssuer := strings.TrimPrefix(iss.URL, "http://")
+	provider := NewOIDCProvider("fake", []string{iss.URL, bareIssuer}, iss.clientIDs)
+	ctx := context.Background()
+
+	valid := func() IDTokenClaims {
+		now := time.Now()
+		return IDTokenClaims{
+			Email:         "ada@example.com",
+			EmailVerified: true,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    iss.URL,
+				Subject:   "subject-1",
+				Audience:  jwt.ClaimStrings{"ios-client"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		key     *Key
+		claims  func(c *IDTokenClaims)
+		wantErr bool
+	}{
+		{name: "valid token", key: iss.key, claims: func(c *IDTokenClaims) {}},
+		{name: "other accepted issuer", key: iss.key, claims: func(c *IDTokenClaims) {
+			c.Issuer = bareIssuer
+		}},
+		{name: "wrong audience", key: iss.key, claims: func(c *IDTokenClaims) {
+			c.Audience = jwt.ClaimStrings{"someone-else"}
+		}, wantErr: true},
+		{name: "wrong issuer", key: iss.key, claims: func(c *IDTokenClaims) {
+			c.Issuer = "https://evil.example.com"
+		}, wantErr: true},
+		{name: "expired token", key: iss.key, claims: func(c *IDTokenClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-10 * time.Minute))
+		}, wantErr: true},
+		{name: "no expiry", key: iss.key, claims: func(c *IDTokenClaims) {
+			c.ExpiresAt = nil
+		}, wantErr: true},
+		{name: "no subject", key: iss.key, claims: func(c *IDTokenClaims) {
+			c.Subject = ""
+		}, wantErr: true},
+		{name: "unknown kid", key: newRSAKey(t, "unknown-key"), claims: func(c *IDTokenClaims) {}, wantErr: true},
+		{name: "known kid, other key", key: &Key{
+			ID: iss.key.ID, Method: jwt.SigningMethodRS256,
+			private: newRSAKey(t, "forged").private,
+		}, claims: func(c *IDTokenClaims) {}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.claims(&claims)
+
+			got, err := provider.Verify(ctx, idToken(t, tt.key, claims))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Verify accepted the token")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if got.Subject != "subject-1" || got.Email != "ada@example.com" || !bool(got.EmailVerified) {
+				t.Errorf("claims = %+v", got)
+			}
+		})
+	}
+
+	// Unknown kids may refetch the key set at most once a jwksRefreshInterval
+	if hits := iss.jwksHits.Load(); hits != 1 {
+		t.Errorf("fetched the key set %d times, want 1", hits)
+	}
+}
+
+// blockingTransport holds every request until release is closed, closing
+// started when the first one arrives.
+type blockingTransport struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (b *blockingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	b.once.Do(func() { close(b.started) })
+	<-b.release
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestOIDCProviderCachedKeyDuringFetch(t *testing.T) {
+	iss := newFakeIssuer(t)
+	provider := NewOIDCProvider("fake", []string{iss.URL}, iss.clientIDs)
+	ctx := context.Background()
+
+	if _, err := provider.key(ctx, iss.key.ID); err != nil {
+		t.Fatalf("key: %v", err)
+	}
+
+	// Let an unknown kid start a refetch that hangs
+	transport := &blockingTransport{started: make(chan struct{}), release: make(chan struct{})}
+	provider.client = &http.Client{Transport: transport}
+	provider.fetchedAt = time.Time{}
+	fetched := make(chan struct{})
+	go func() {
+		provider.key(ctx, "unknown-key")
+		close(fetched)
+	}()
+	<-transport.started
+
+	cached := make(chan error, 1)
+	go func() {
+		_, err := provider.key(ctx, iss.key.ID)
+		cached <- err
+	}()
+	select {
+	case err := <-cached:
+		if err != nil {
+			t.Errorf("cached key: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("cached key lookup waited for the fetch")
+	}
+
+	close(transport.release)
+	<-fetched
+}
+
+func TestOIDCProviderRejectsHMACWithPublicKey(t *testing.T) {
+	iss := newFakeIssuer(t)
+	provider := NewOIDCProvider("fake", []string{iss.URL}, iss.clientIDs)
+
+	// Signing HS256 with the published key must not pass as the RSA key
+	jwk, _ := iss.key.jwk()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    iss.URL,
+			Subject:   "subject-1",
+			Audience:  jwt.ClaimStrings{"web-client"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	token.Header["kid"] = iss.key.ID
+	signed, err := token.SignedString([]byte(jwk.N))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := provider.Verify(context.Background(), signed); err == nil {
+		t.Fatal("Verify accepted an HS256 token")
+	}
+}
+
+func TestFlexBool(t *testing.T) {
+	for input, want := range map[string]bool{`true`: true, `false`: false, `"true"`: true, `"false"`: false} {
+		var b flexBool
+		if err := json.Unmarshal([]byte(input), &b); err != nil || bool(b) != want {
+			t.Errorf("%s: got %v, %v; want %v", input, b, err, want)
+		}
+	}
+}
+
+func TestLinkIdentityConcurrentFirstLogins(t *testing.T) {
+	pool := dbtest.Postgres(t)
+	h := &Handler{db: pool}
+	ctx := context.Background()
+
+	subject := fmt.Sprintf("subject-%d", time.Now().UnixNano())
+	claims := &IDTokenClaims{
+		Email:            subject + "@example.com",
+		EmailVerified:    true,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: subject},
+	}
+
+	const logins = 8
+	type result struct {
+		userID  string
+		created bool
+		err     error
+	}
+	results := make(chan result, logins)
+	start := make(chan struct{})
+	for i := 0; i < logins; i++ {
+		go func() {
+			<-start
+			userID, created, err := h.linkIdentity(ctx, "fake", claims)
+			results <- result{userID, created, err}
+		}()
+	}
+	close(start)
+
+	var userID string
+	createdCount := 0
+	for i := 0; i < logins; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("linkIdentity: %v", r.err)
+		}
+		if userID == "" {
+			userID = r.userID
+			t.Cleanup(func() { pool.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID) })
+		}
+		if r.userID != userID {
+			t.Fatalf("logins returned users %s and %s", userID, r.userID)
+		}
+		if r.created {
+			createdCount++
+		}
+	}
+	if createdCount != 1 {
+		t.Errorf("%d logins created the account, want 1", createdCount)
+	}
+}
+
+func TestOIDCLoginNonce(t *testing.T) {
+	h, _ := newMailTestHandler(t)
+	iss := newFakeIssuer(t)
+	provider := NewOIDCProvider("fake", []string{iss.URL}, iss.clientIDs)
+	h.providers[provider.Name] = provider
+	ctx := context.Background()
+
+	router := chi.NewRouter()
+	router.Post("/oidc/{provider}", h.OIDCLogin)
+	router.Post("/oidc/{provider}/nonce", h.OIDCNonce)
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(b))))
+		return rec
+	}
+
+	// token signs in a new identity, which is deleted when the test ends
+	token := func(nonce string) string {
+		subject := fmt.Sprintf("subject-%d", time.Now().UnixNano())
+		t.Cleanup(func() {
+			h.db.Exec(ctx,
+				`DELETE FROM users WHERE id IN (
+				    SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2)`,
+				provider.Name, subject)
+		})
+		now := time.Now()
+		return idToken(t, iss.key, IDTokenClaims{
+			Email:         subject + "@example.com",
+			EmailVerified: true,
+			Nonce:         nonce,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    iss.URL,
+				Subject:   subject,
+				Audience:  jwt.ClaimStrings{"ios-client"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+		})
+	}
+
+	t.Run("issued nonce", func(t *testing.T) {
+		rec := post("/oidc/fake/nonce", nil)
+		var issued struct {
+			Nonce string `json:"nonce"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&issued); err != nil || issued.Nonce == "" {
+			t.Fatalf("issue nonce: status %d, %v", rec.Code, err)
+		}
+
+		raw := token(issued.Nonce)
+		if rec := post("/oidc/fake", oidcLoginRequest{IDToken: raw}); rec.Code != http.StatusCreated {
+			t.Fatalf("login: status %d, want %d", rec.Code, http.StatusCreated)
+		}
+		if rec := post("/oidc/fake", oidcLoginRequest{IDToken: raw}); rec.Code != http.StatusUnauthorized {
+			t.Errorf("replayed login: status %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("nonce the server did not issue", func(t *testing.T) {
+		if rec := post("/oidc/fake", oidcLoginRequest{IDToken: token("chosen-by-client")}); rec.Code != http.StatusUnauthorized {
+			t.Errorf("login: status %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("no nonce", func(t *testing.T) {
+		raw := token("")
+		if rec := post("/oidc/fake", oidcLoginRequest{IDToken: raw}); rec.Code != http.StatusCreated {
+			t.Fatalf("login: status %d, want %d", rec.Code, http.StatusCreated)
+		}
+		if rec := post("/oidc/fake", oidcLoginRequest{IDToken: raw}); rec.Code != http.StatusUnauthorized {
+			t.Errorf("replayed login: status %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("no nonce when required", func(t *testing.T) {
+		provider.RequireNonce = true
+		defer func() { provider.RequireNonce = false }()
+		if rec := post("/oidc/fake", oidcLoginRequest{IDToken: token("")}); rec.Code != http.StatusUnauthorized {
+			t.Errorf("login: status %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var errTokenInvalid = errors.New("token invalid or expired")
+
+// oneTimeTokens issues and consumes hashed, single-use, expiring tokens kept in
+// a table with user_id, token_hash, expires_at and used_at columns. Only the
+// hash is stored, so a database leak does not expose usable tokens.
+type oneTimeTokens struct {
+	db    *pgxpool.Pool
+	table string
+	ttl   time.Duration
+}
+
+func newOneTimeTokens(db *pgxpool.Pool, table string, ttl time.Duration) *oneTimeTokens {
+	return &oneTimeTokens{db: db, table: table, ttl: ttl}
+}
+
+// Issue creates a token for the user and returns it in plain text.
+func (s *oneTimeTokens) Issue(ctx context.Context, userID string) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.db.Exec(ctx,
+		fmt.Sprintf(`INSERT INTO %s (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`, s.table),
+		userID, hashToken(token), time.Now().Add(s.ttl))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Consume redeems a token and returns the user it was issued to. Any other
+// outstanding tokens of that user are spent along with it.
+func (s *oneTimeTokens) Consume(ctx context.Context, token string) (string, error) {
+	var userID string
+	err := s.db.QueryRow(ctx,
+		fmt.Sprintf(`UPDATE %s SET used_at = NOW()
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id`, s.table),
+		hashToken(token)).Scan(&userID)
+	if err != nil {
+		return "", errTokenInvalid
+	}
+
+	_, _ = s.db.Exec(ctx,
+		fmt.Sprintf(`UPDATE %s SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, s.table),
+		userID)
+
+	return userID, nil
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/uniqsocial/backend/internal/mail"
+	"github.com/uniqsocial/backend/pkg/response"
+)
+
+const passwordResetTTL = time.Hour
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ForgotPassword emails a reset link if the address belongs to an account. It
+// answers the same way either way so it cannot be used to probe for accounts.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	email := strings.TrimSpace(strings.ToLower(req.Email))
+	if h.throttleMail(w, r, "reset", email) {
+		return
+	}
+
+	var userID string
+	err := h.db.QueryRow(r.Context(),
+		`SELECT id FROM users WHERE email = $1`, email).Scan(&userID)
+	if err == nil {
+		// Send in the background so response time does not reveal whether
+		// the account exists.
+		go h.sendPasswordReset(userID, email)
+	}
+
+	response.JSON(w, http.StatusAccepted, map[string]string{
+		"status": "if that email is registered, a reset link has been sent",
+	})
+}
+
+// throttleMail counts a request to email the address and replies 429 once the
+// address or the client IP has asked too often. Every request counts, sent or
+// not, so the limit does not reveal which addresses have accounts.
+func (h *Handler) throttleMail(w http.ResponseWriter, r *http.Request, kind, email string) bool {
+	subject := kind + ":" + email
+	ip := clientIP(r)
+	if wait := h.limiter.Check(r.Context(), subject, ip); wait > 0 {
+		response.TooManyRequests(w, wait, "too many requests, try again later")
+		return true
+	}
+	h.limiter.RecordFailure(r.Context(), subject, ip)
+	return false
+}
+
+func (h *Handler) sendPasswordReset(userID, email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	token, err := h.passwordResets.Issue(ctx, userID)
+	if err != nil {
+		log.Printf("auth: issue password reset: %v", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.appURL, url.QueryEscape(token))
+	err = h.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Reset your UniqSocial password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your UniqSocial account.\n\n"+
+			"Open this link within %d minutes to choose a new one:\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.", int(passwordResetTTL.Minutes()), link),
+	})
+	if err != nil {
+		log.Printf("auth: send password reset: %v", err)
+	}
+}
+
+// ResetPassword sets a new password using a reset token and signs the user out
+// everywhere.
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if len(req.Password) < 8 {
+		response.Error(w, http.StatusBadRequest, "password must be at least 8 characters")
+		return
+	}
+
+	userID, err := h.passwordResets.Consume(r.Context(), req.Token)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid or expired reset token")
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to hash password")
+		return
+	}
+
+	_, err = h.db.Exec(r.Context(),
+		`UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`,
+		string(hash), userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to update password")
+		return
+	}
+
+	if err := h.RevokeAllSessions(r.Context(), userID); err != nil {
+		log.Printf("auth: revoke sessions after password reset: %v", err)
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"status": "password_reset"})
+}
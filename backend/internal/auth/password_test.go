@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/uniqsocial/backend/internal/db/dbtest"
+	"github.com/uniqsocial/backend/internal/mail"
+)
+
+var resetLinkRegex = regexp.MustCompile(`/reset-password\?token=(\S+)`)
+
+// newMailTestHandler returns a handler on the test databases that sends mail
+// to a MemoryMailer. Mail requests are delayed from the fourth one per
+// address on.
+func newMailTestHandler(t *testing.T) (*Handler, *mail.MemoryMailer) {
+	t.Helper()
+	pool := dbtest.Postgres(t)
+	rdb := dbtest.Redis(t)
+
+	jwtSvc := NewJWTService(NewHMACKey("test", []byte("test-secret")), nil, 15*time.Minute, time.Hour)
+	limiter := NewLoginLimiter(rdb, LoginLimits{
+		Window:        time.Minute,
+		Lockout:       time.Minute,
+		MaxFailures:   10,
+		MaxIPFailures: 1000,
+		DelayAfter:    3,
+		BaseDelay:     time.Minute,
+	})
+	mailer := mail.NewMemoryMailer()
+	h := NewHandler(pool, jwtSvc, NewRevocations(rdb, 15*time.Minute), limiter, mailer, "https://app.example.com", nil)
+	return h, mailer
+}
+
+func postJSON(t *testing.T, handler http.HandlerFunc, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+	return rec
+}
+
+// awaitMail waits for the mailer to have sent n messages, as mail is sent in
+// the background.
+func awaitMail(t *testing.T, mailer *mail.MemoryMailer, n int) []mail.Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		msgs := mailer.Messages()
+		if len(msgs) >= n {
+			return msgs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d messages, want %d", len(msgs), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func resetToken(t *testing.T, msg mail.Message) string {
+	t.Helper()
+	m := resetLinkRegex.FindStringSubmatch(msg.Body)
+	if m == nil {
+		t.Fatalf("no reset link in %q", msg.Body)
+	}
+	token, err := url.QueryUnescape(m[1])
+	if err != nil {
+		t.Fatalf("unescape token: %v", err)
+	}
+	return token
+}
+
+func userEmail(t *testing.T, h *Handler, userID string) string {
+	t.Helper()
+	var email string
+	if err := h.db.QueryRow(context.Background(),
+		`SELECT email FROM users WHERE id = $1`, userID).Scan(&email); err != nil {
+		t.Fatalf("load email: %v", err)
+	}
+	return email
+}
+
+func TestPasswordReset(t *testing.T) {
+	h, mailer := newMailTestHandler(t)
+	ctx := context.Background()
+	userID := dbtest.CreateUser(t, h.db, dbtest.User{})
+	email := userEmail(t, h, userID)
+
+	if rec := postJSON(t, h.ForgotPassword, forgotPasswordRequest{Email: email}); rec.Code != http.StatusAccepted {
+		t.Fatalf("forgot password: status %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	msgs := awaitMail(t, mailer, 1)
+	if msgs[0].To != email {
+		t.Errorf("mail sent to %q, want %q", msgs[0].To, email)
+	}
+	token := resetToken(t, msgs[0])
+
+	// Only the hash of the token is stored
+	var hashed, plain bool
+	err := h.db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM password_resets WHERE user_id = $1 AND token_hash = $2),
+		        EXISTS (SELECT 1 FROM password_resets WHERE token_hash = $3)`,
+		userID, hashToken(token), token).Scan(&hashed, &plain)
+	if err != nil {
+		t.Fatalf("load reset: %v", err)
+	}
+	if !hashed || plain {
+		t.Errorf("stored hashed = %v, plain = %v; want only the hash", hashed, plain)
+	}
+
+	const password = "correct horse battery"
+	rec := postJSON(t, h.ResetPassword, resetPasswordRequest{Token: token, Password: password})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reset password: status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var hash string
+	if err := h.db.QueryRow(ctx,
+		`SELECT password_hash FROM users WHERE id = $1`, userID).Scan(&hash); err != nil {
+		t.Fatalf("load password: %v", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		t.Error("password was not changed")
+	}
+
+	rec = postJSON(t, h.ResetPassword, resetPasswordRequest{Token: token, Password: "another password"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("second reset with the same token: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPasswordResetExpired(t *testing.T) {
+	h, mailer := newMailTestHandler(t)
+	userID := dbtest.CreateUser(t, h.db, dbtest.User{})
+
+	postJSON(t, h.ForgotPassword, forgotPasswordRequest{Email: userEmail(t, h, userID)})
+	token := resetToken(t, awaitMail(t, mailer, 1)[0])
+
+	if _, err := h.db.Exec(context.Background(),
+		`UPDATE password_resets SET expires_at = NOW() - INTERVAL '1 second' WHERE user_id = $1`,
+		userID); err != nil {
+		t.Fatalf("expire reset: %v", err)
+	}
+
+	rec := postJSON(t, h.ResetPassword, resetPasswordRequest{Token: token, Password: "correct horse battery"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("reset with an expired token: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestForgotPasswordThrottled(t *testing.T) {
+	h, _ := newMailTestHandler(t)
+	// Unregistered addresses are throttled too, or the limit would reveal
+	// which addresses have accounts
+	email := "nobody-" + time.Now().Format("150405.000000000") + "@example.com"
+
+	for i := 0; i < 3; i++ {
+		if rec := postJSON(t, h.ForgotPassword, forgotPasswordRequest{Email: email}); rec.Code != http.StatusAccepted {
+			t.Fatalf("request %d: status %d, want %d", i+1, rec.Code, http.StatusAccepted)
+		}
+	}
+	rec := postJSON(t, h.ForgotPassword, forgotPasswordRequest{Email: email})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("request 4: status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+}
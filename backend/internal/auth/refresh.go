@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	errRefreshInvalid = errors.New("refresh token invalid")
+	errRefreshReused  = errors.New("refresh token reused")
+)
+
+// refreshStore persists refresh tokens so each one can be used exactly once.
+// Every rotation stays in the family of the login that started it; replaying
+// an already rotated token revokes the whole family.
+type refreshStore struct {
+	db  *pgxpool.Pool
+	ttl time.Duration
+}
+
+func newRefreshStore(db *pgxpool.Pool, ttl time.Duration) *refreshStore {
+	return &refreshStore{db: db, ttl: ttl}
+}
+
+// Create records a new refresh token and returns its id, to be used as the
+// token's jti, and its family. An empty familyID starts a new family.
+func (s *refreshStore) Create(ctx context.Context, userID, familyID string) (id, family string, err error) {
+	err = s.db.QueryRow(ctx,
+		`INSERT INTO refresh_tokens (user_id, family_id, expires_at)
+		 VALUES ($1, COALESCE(NULLIF($2, '')::uuid, uuid_generate_v4()), $3)
+		 RETURNING id, family_id`,
+		userID, familyID, time.Now().Add(s.ttl)).Scan(&id, &family)
+	return id, family, err
+}
+
+// Rotate marks a refresh token as used and returns its user and family.
+func (s *refreshStore) Rotate(ctx context.Context, id string) (userID, familyID string, err error) {
+	err = s.db.QueryRow(ctx,
+		`UPDATE refresh_tokens SET used_at = NOW()
+		 WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id, family_id`,
+		id).Scan(&userID, &familyID)
+	if err == nil {
+		return userID, familyID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", "", errRefreshInvalid
+	}
+
+	var used bool
+	err = s.db.QueryRow(ctx,
+		`SELECT family_id, used_at IS NOT NULL FROM refresh_tokens WHERE id = $1`,
+		id).Scan(&familyID, &used)
+	if err != nil || !used {
+		return "", "", errRefreshInvalid
+	}
+
+	// A token that was already exchanged is being replayed: either the client
+	// or an attacker holds a stolen copy, so end the session for both.
+	if err := s.RevokeFamily(ctx, familyID); err != nil {
+		return "", "", err
+	}
+	return "", "", errRefreshReused
+}
+
+// Family returns the family a refresh token belongs to.
+func (s *refreshStore) Family(ctx context.Context, id string) (string, error) {
+	var familyID string
+	err := s.db.QueryRow(ctx,
+		`SELECT family_id FROM refresh_tokens WHERE id = $1`, id).Scan(&familyID)
+	if err != nil {
+		return "", errRefreshInvalid
+	}
+	return familyID, nil
+}
+
+// RevokeFamily revokes every outstanding token in a family.
+func (s *refreshStore) RevokeFamily(ctx context.Context, familyID string) error {
+	_, err := s.db.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE family_id = $1 AND revoked_at IS NULL`,
+		familyID)
+	return err
+}
+
+// RevokeUser revokes every outstanding token of a user, across all families.
+func (s *refreshStore) RevokeUser(ctx context.Context, userID string) error {
+	_, err := s.db.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE user_id = $1 AND revoked_at IS NULL`,
+		userID)
+	return err
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Revocations tracks access tokens that must stop working before they expire:
+// individual tokens revoked by logout, and every token older than a user's
+// current token version after "log out of all devices". It also records which
+// single-use tokens, such as MFA login tokens and ID tokens, have been spent,
+// and issues the nonces OIDC sign-ins are started with.
+type Revocations struct {
+	rdb       *redis.Client
+	accessTTL time.Duration
+}
+
+func NewRevocations(rdb *redis.Client, accessTTL time.Duration) *Revocations {
+	return &Revocations{rdb: rdb, accessTTL: accessTTL}
+}
+
+func revokedTokenKey(tokenID string) string {
+	return fmt.Sprintf("auth:revoked:%s", tokenID)
+}
+
+func spentTokenKey(tokenID string) string {
+	return fmt.Sprintf("auth:spent:%s", tokenID)
+}
+
+func spentIDTokenKey(provider, tokenHash string) string {
+	return fmt.Sprintf("auth:spent_id_token:%s:%s", provider, tokenHash)
+}
+
+func nonceKey(provider, nonce string) string {
+	return fmt.Sprintf("auth:nonce:%s:%s", provider, nonce)
+}
+
+func tokenVersionKey(userID string) string {
+	return fmt.Sprintf("auth:token_version:%s", userID)
+}
+
+// RevokeAccessToken blacklists an access token until it expires.
+func (s *Revocations) RevokeAccessToken(ctx context.Context, claims *Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.rdb.Set(ctx, revokedTokenKey(claims.ID), 1, ttl).Err()
+}
+
+// SpendToken marks a single-use token as used until it expires, and reports
+// false if it had already been used.
+func (s *Revocations) SpendToken(ctx context.Context, claims *Claims) (bool, error) {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return false, nil
+	}
+	return s.spend(ctx, spentTokenKey(claims.ID), claims.ExpiresAt.Time)
+}
+
+// SpendIDToken marks an identity provider's ID token as used until it
+// expires, and reports false if it had already been used.
+func (s *Revocations) SpendIDToken(ctx context.Context, provider, rawToken string, expiresAt time.Time) (bool, error) {
+	return s.spend(ctx, spentIDTokenKey(provider, hashToken(rawToken)), expiresAt)
+}
+
+// IssueNonce returns a nonce for a sign-in with the provider, valid for ttl.
+func (s *Revocations) IssueNonce(ctx context.Context, provider string, ttl time.Duration) (string, error) {
+	nonce, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := s.rdb.Set(ctx, nonceKey(provider, nonce), 1, ttl).Err(); err != nil {
+		return "", err
+	}
+	return nonce, nil
+}
+
+// RedeemNonce reports whether the nonce was issued for the provider and has
+// not expired or been redeemed before.
+func (s *Revocations) RedeemNonce(ctx context.Context, provider, nonce string) (bool, error) {
+	err := s.rdb.GetDel(ctx, nonceKey(provider, nonce)).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Revocations) spend(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return false, nil
+	}
+	return s.rdb.SetNX(ctx, key, 1, ttl).Result()
+}
+
+// IsSpent reports whether a single-use token has already been used.
+func (s *Revocations) IsSpent(ctx context.Context, claims *Claims) bool {
+	return claims.ID != "" && s.rdb.Exists(ctx, spentTokenKey(claims.ID)).Val() > 0
+}
+
+// SetTokenVersion rejects access tokens issued with an older version. The
+// marker only has to outlive the access tokens it invalidates.
+func (s *Revocations) SetTokenVersion(ctx context.Context, userID string, version int) error {
+	return s.rdb.Set(ctx, tokenVersionKey(userID), version, s.accessTTL).Err()
+}
+
+// IsRevoked reports whether an access token has been revoked.
+func (s *Revocations) IsRevoked(ctx context.Context, claims *Claims) bool {
+	if claims.ID != "" && s.rdb.Exists(ctx, revokedTokenKey(claims.ID)).Val() > 0 {
+		return true
+	}
+
+	v, err := s.rdb.Get(ctx, tokenVersionKey(claims.UserID)).Result()
+	if err != nil {
+		return false
+	}
+	version, err := strconv.Atoi(v)
+	return err == nil && claims.Version < version
+}
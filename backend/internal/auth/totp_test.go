@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uniqsocial/backend/internal/db/dbtest"
+)
+
+// rfcSecret is the shared secret of the RFC 4226 and RFC 6238 test vectors.
+const rfcSecret = "12345678901234567890"
+
+func TestHOTPRFC4226(t *testing.T) {
+	// RFC 4226 appendix D
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for counter, code := range want {
+		if got := hotp([]byte(rfcSecret), int64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestValidateTOTPRFC6238(t *testing.T) {
+	// RFC 6238 appendix B for SHA-1, cut to the last six of its eight digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	secret := totpEncoding.EncodeToString([]byte(rfcSecret))
+	for _, tt := range tests {
+		step, ok := validateTOTP(secret, tt.code, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Errorf("validateTOTP(%s) at %d rejected", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("validateTOTP(%s) at %d = step %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte(rfcSecret))
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+	key := []byte(rfcSecret)
+
+	for offset := int64(-2); offset <= 2; offset++ {
+		step, ok := validateTOTP(secret, hotp(key, current+offset), now)
+		if wantOK := offset >= -totpSkew && offset <= totpSkew; ok != wantOK {
+			t.Errorf("code %+d steps from now: accepted = %v, want %v", offset, ok, wantOK)
+			continue
+		}
+		// The step the code belongs to, not the current one, is what a
+		// reused code is recognised by
+		if ok && step != current+offset {
+			t.Errorf("code %+d steps from now matched step %d, want %d", offset, step, current+offset)
+		}
+	}
+
+	if _, ok := validateTOTP(secret, "12345", now); ok {
+		t.Error("accepted a code with too few digits")
+	}
+	if _, ok := validateTOTP("not base32!", hotp(key, current), now); ok {
+		t.Error("accepted a code for an invalid secret")
+	}
+}
+
+func TestCheckSecondFactor(t *testing.T) {
+	pool := dbtest.Postgres(t)
+	h := &Handler{db: pool}
+	ctx := context.Background()
+	userID := dbtest.CreateUser(t, pool, dbtest.User{})
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		t.Fatalf("new secret: %v", err)
+	}
+	if _, err := pool.Exec(ctx, `UPDATE users SET totp_secret = $1 WHERE id = $2`, secret, userID); err != nil {
+		t.Fatalf("store secret: %v", err)
+	}
+	codes, err := h.enableTOTP(ctx, userID, 0)
+	if err != nil {
+		t.Fatalf("enable totp: %v", err)
+	}
+
+	key, _ := totpEncoding.DecodeString(secret)
+	current := time.Now().Unix() / totpPeriod
+
+	t.Run("totp", func(t *testing.T) {
+		if !h.checkSecondFactor(ctx, userID, hotp(key, current)) {
+			t.Fatal("current code rejected")
+		}
+		if h.checkSecondFactor(ctx, userID, hotp(key, current)) {
+			t.Error("current code accepted twice")
+		}
+		// Still in the window, but older than the step already used
+		if h.checkSecondFactor(ctx, userID, hotp(key, current-1)) {
+			t.Error("code older than the last used step accepted")
+		}
+	})
+
+	t.Run("recovery code", func(t *testing.T) {
+		if !h.checkSecondFactor(ctx, userID, codes[0]) {
+			t.Fatal("recovery code rejected")
+		}
+		if h.checkSecondFactor(ctx, userID, codes[0]) {
+			t.Error("recovery code accepted twice")
+		}
+		// Codes are accepted however they are typed
+		if !h.checkSecondFactor(ctx, userID, " "+strings.ToUpper(codes[1])+" ") {
+			t.Error("recovery code typed in upper case rejected")
+		}
+		if h.checkSecondFactor(ctx, userID, "00000-00000") {
+			t.Error("unknown recovery code accepted")
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/uniqsocial/backend/internal/mail"
+	"github.com/uniqsocial/backend/pkg/response"
+)
+
+const emailVerificationTTL = 48 * time.Hour
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+func (h *Handler) sendEmailVerification(userID, email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	token, err := h.emailVerifications.Issue(ctx, userID)
+	if err != nil {
+		log.Printf("auth: issue email verification: %v", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", h.appURL, url.QueryEscape(token))
+	err = h.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your UniqSocial email",
+		Body: fmt.Sprintf("Welcome to UniqSocial!\n\n"+
+			"Confirm your email address to start getting matched:\n%s\n\n"+
+			"The link expires in %d hours.", link, int(emailVerificationTTL.Hours())),
+	})
+	if err != nil {
+		log.Printf("auth: send email verification: %v", err)
+	}
+}
+
+// VerifyEmail marks the user's email as verified, which makes them matchable.
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req verifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	userID, err := h.emailVerifications.Consume(r.Context(), req.Token)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid or expired verification token")
+		return
+	}
+
+	_, err = h.db.Exec(r.Context(),
+		`UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		 WHERE id = $1`,
+		userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to verify email")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"status": "verified"})
+}
+
+// ResendVerification emails a fresh verification link to the current user,
+// throttled per address and client IP like password reset mail.
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserID(r.Context())
+
+	var email string
+	var verified bool
+	err := h.db.QueryRow(r.Context(),
+		`SELECT email, email_verified_at IS NOT NULL FROM users WHERE id = $1`,
+		userID).Scan(&email, &verified)
+	if err != nil {
+		response.Error(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if verified {
+		response.Error(w, http.StatusConflict, "email already verified")
+		return
+	}
+
+	if h.throttleMail(w, r, "verify", email) {
+		return
+	}
+
+	go h.sendEmailVerification(userID, email)
+
+	response.JSON(w, http.StatusAccepted, map[string]string{"status": "verification email sent"})
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/uniqsocial/backend/internal/db/dbtest"
+)
+
+func TestResendVerificationThrottled(t *testing.T) {
+	h, mailer := newMailTestHandler(t)
+	userID := dbtest.CreateUser(t, h.db, dbtest.User{})
+	if _, err := h.db.Exec(context.Background(),
+		`UPDATE users SET email_verified_at = NULL WHERE id = $1`, userID); err != nil {
+		t.Fatalf("unverify user: %v", err)
+	}
+
+	resend := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), UserIDKey, userID))
+		rec := httptest.NewRecorder()
+		h.ResendVerification(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		if rec := resend(); rec.Code != http.StatusAccepted {
+			t.Fatalf("request %d: status %d, want %d", i+1, rec.Code, http.StatusAccepted)
+		}
+	}
+	awaitMail(t, mailer, 3)
+
+	if rec := resend(); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("request 4: status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/uniqsocial/backend/pkg/response"
+)
+
+// WebSocketProtocol is the subprotocol a client offers, followed by its access
+// token, to authenticate through the Sec-WebSocket-Protocol header:
+//
+//	new WebSocket(url, ["bearer", accessToken])
+//
+// The server must echo it back for the handshake to succeed.
+const WebSocketProtocol = "bearer"
+
+// WebSocketMiddleware authenticates WebSocket handshakes. Browsers and React
+// Native cannot set an Authorization header on a WebSocket, so besides the
+// header it accepts, in order of preference, a single-use ticket query
+// parameter, a bearer token offered as a subprotocol, or a token query
+// parameter.
+func WebSocketMiddleware(jwtSvc *JWTService, revocations *Revocations, tickets *TicketStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+
+			var userID string
+			if ticket := query.Get("ticket"); ticket != "" {
+				id, err := tickets.Redeem(r.Context(), ticket)
+				if err != nil {
+					response.Error(w, http.StatusUnauthorized, "invalid or expired ticket")
+					return
+				}
+				userID = id
+			} else {
+				token := protocolToken(r)
+				if token == "" {
+					token = query.Get("token")
+				}
+				if token == "" {
+					token = headerToken(r)
+				}
+				if token == "" {
+					response.Error(w, http.StatusUnauthorized, "missing credentials")
+					return
+				}
+
+				claims, status, msg := authenticate(r.Context(), jwtSvc, revocations, token)
+				if claims == nil {
+					response.Error(w, status, msg)
+					return
+				}
+				userID = claims.UserID
+			}
+
+			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// protocolToken returns the token following the "bearer" entry in the
+// Sec-WebSocket-Protocol header, if any.
+func protocolToken(r *http.Request) string {
+	var protocols []string
+	for _, h := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(h, ",") {
+			protocols = append(protocols, strings.TrimSpace(p))
+		}
+	}
+	for i := 0; i+1 < len(protocols); i++ {
+		if strings.EqualFold(protocols[i], WebSocketProtocol) {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
+
+// headerToken returns the bearer token from the Authorization header, if any.
+func headerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return ""
+	}
+	return parts[1]
+}
+
+// RedactCredentials masks the token and ticket query parameters in the request
+// URI so request logging never records them. It must run before the logger.
+func RedactCredentials(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Has("token") || query.Has("ticket") {
+			for _, key := range []string{"token", "ticket"} {
+				if query.Has(key) {
+					query.Set(key, "REDACTED")
+				}
+			}
+			u := *r.URL
+			u.RawQuery = query.Encode()
+			r = r.WithContext(r.Context())
+			r.RequestURI = u.RequestURI()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
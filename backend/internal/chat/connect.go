@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/uniqsocial/backend/internal/auth"
+	"github.com/uniqsocial/backend/pkg/response"
+)
+
+type ConnectionResponse struct {
+	SessionID       string    `json:"session_id"`
+	PartnerID       string    `json:"partner_id"`
+	PartnerUsername string    `json:"partner_username"`
+	PartnerPhoto    *string   `json:"partner_photo"`
+	ConnectedAt     time.Time `json:"connected_at"`
+}
+
+// Connect records that a user wants to keep chatting after tonight. Once both
+// users have asked before the session ends it becomes a connection, which
+// the midnight cleanup leaves open.
+func (h *Handler) Connect(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+	sessionID := chi.URLParam(r, "sessionId")
+
+	// The row lock taken by the update makes the second of two concurrent
+	// requests see the first one's consent
+	var status string
+	err := h.db.QueryRow(context.Background(),
+		`UPDATE chat_sessions SET
+		    user1_connect_at = CASE WHEN user1_id = $2 THEN COALESCE(user1_connect_at, NOW()) ELSE user1_connect_at END,
+		    user2_connect_at = CASE WHEN user2_id = $2 THEN COALESCE(user2_connect_at, NOW()) ELSE user2_connect_at END,
+		    status = CASE
+		        WHEN (user1_id = $2 OR user1_connect_at IS NOT NULL) AND (user2_id = $2 OR user2_connect_at IS NOT NULL)
+		        THEN 'connected'::chat_status ELSE status END,
+		    connected_at = CASE
+		        WHEN (user1_id = $2 OR user1_connect_at IS NOT NULL) AND (user2_id = $2 OR user2_connect_at IS NOT NULL)
+		        THEN NOW() ELSE connected_at END
+		 WHERE id = $1 AND (user1_id = $2 OR user2_id = $2)
+		   AND status = 'active' AND ends_at > NOW()
+		 RETURNING status::text`,
+		sessionID, userID).Scan(&status)
+	if err != nil {
+		response.Error(w, http.StatusNotFound, "active session not found")
+		return
+	}
+
+	eventType := "connect_requested"
+	if status == "connected" {
+		eventType = "connected"
+	}
+	data, _ := json.Marshal(WSMessage{
+		Type:      eventType,
+		SessionID: sessionID,
+		SenderID:  userID,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+	h.hub.broadcast <- &Envelope{
+		SessionID: sessionID,
+		Data:      data,
+		SenderID:  userID,
+	}
+
+	if status != "connected" {
+		status = "pending"
+	}
+	response.JSON(w, http.StatusOK, map[string]string{"status": status})
+}
+
+// GetConnections lists the user's open connections, most recent first.
+func (h *Handler) GetConnections(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+
+	rows, err := h.db.Query(context.Background(),
+		`SELECT cs.id, u.id, u.username, u.photo_url, cs.connected_at
+		 FROM chat_sessions cs
+		 JOIN users u ON u.id = CASE WHEN cs.user1_id = $1 THEN cs.user2_id ELSE cs.user1_id END
+		 WHERE (cs.user1_id = $1 OR cs.user2_id = $1) AND cs.status = 'connected'
+		 ORDER BY cs.connected_at DESC`,
+		userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to fetch connections")
+		return
+	}
+	defer rows.Close()
+
+	connections := []ConnectionResponse{}
+	for rows.Next() {
+		var c ConnectionResponse
+		if err := rows.Scan(&c.SessionID, &c.PartnerID, &c.PartnerUsername, &c.PartnerPhoto, &c.ConnectedAt); err != nil {
+			continue
+		}
+		connections = append(connections, c)
+	}
+
+	response.JSON(w, http.StatusOK, connections)
+}
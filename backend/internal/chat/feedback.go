@@ -0,0 +1,103 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/uniqsocial/backend/internal/auth"
+	"github.com/uniqsocial/backend/pkg/response"
+)
+
+// feedbackTags are the quick reactions a user can attach to a rating.
+var feedbackTags = map[string]bool{
+	"great_conversation": true,
+	"funny":              true,
+	"kind":               true,
+	"shared_interests":   true,
+	"boring":             true,
+	"rude":               true,
+	"unresponsive":       true,
+	"inappropriate":      true,
+}
+
+type FeedbackRequest struct {
+	Rating         int      `json:"rating"`
+	Tags           []string `json:"tags"`
+	WouldChatAgain bool     `json:"would_chat_again"`
+}
+
+// SubmitFeedback records how a user felt about a chat once it has ended, or
+// for a connection once its night is over. Sending it again replaces the
+// earlier feedback. Skipped matches cannot be rated, so a skip does not also
+// count against the partner's reception.
+func (h *Handler) SubmitFeedback(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+	sessionID := chi.URLParam(r, "sessionId")
+
+	var req FeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Rating < 1 || req.Rating > 5 {
+		response.Error(w, http.StatusBadRequest, "rating must be between 1 and 5")
+		return
+	}
+	if req.Tags == nil {
+		req.Tags = []string{}
+	}
+	for _, tag := range req.Tags {
+		if !feedbackTags[tag] {
+			response.Error(w, http.StatusBadRequest, "unknown tag: "+tag)
+			return
+		}
+	}
+
+	// Verify user took part in this session and that its night is over
+	var user1, user2 string
+	var open, skipped bool
+	err := h.db.QueryRow(context.Background(),
+		`SELECT user1_id, user2_id,
+		        status = 'active' OR (status = 'connected' AND COALESCE(ends_at > NOW(), TRUE)),
+		        status = 'skipped'
+		 FROM chat_sessions WHERE id = $1`,
+		sessionID).Scan(&user1, &user2, &open, &skipped)
+	if err != nil || (userID != user1 && userID != user2) {
+		response.Error(w, http.StatusForbidden, "not authorized for this session")
+		return
+	}
+	if open {
+		response.Error(w, http.StatusConflict, "chat has not ended yet")
+		return
+	}
+	if skipped {
+		response.Error(w, http.StatusConflict, "skipped matches cannot be rated")
+		return
+	}
+
+	partnerID := user1
+	if userID == user1 {
+		partnerID = user2
+	}
+
+	tags, _ := json.Marshal(req.Tags)
+	_, err = h.db.Exec(context.Background(),
+		`INSERT INTO session_feedback (session_id, from_user_id, to_user_id, rating, tags, would_chat_again)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (session_id, from_user_id) DO UPDATE SET
+		    rating = EXCLUDED.rating, tags = EXCLUDED.tags,
+		    would_chat_again = EXCLUDED.would_chat_again, updated_at = NOW()`,
+		sessionID, userID, partnerID, req.Rating, tags, req.WouldChatAgain)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to save feedback")
+		return
+	}
+
+	h.hub.scoringSvc.UpdateReception(context.Background(), partnerID)
+
+	response.JSON(w, http.StatusOK, req)
+}
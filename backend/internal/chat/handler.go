@@ -20,13 +20,15 @@ var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 	CheckOrigin:     func(r *http.Request) bool { return true },
+	Subprotocols:    []string{auth.WebSocketProtocol},
 }
 
 type Handler struct {
-	db     *pgxpool.Pool
-	rdb    *redis.Client
-	hub    *Hub
-	jwtSvc *auth.JWTService
+	db      *pgxpool.Pool
+	rdb     *redis.Client
+	hub     *Hub
+	jwtSvc  *auth.JWTService
+	tickets *auth.TicketStore
 }
 
 type MessageResponse struct {
@@ -37,28 +39,45 @@ type MessageResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
-func NewHandler(db *pgxpool.Pool, rdb *redis.Client, hub *Hub, jwtSvc *auth.JWTService) *Handler {
-	return &Handler{db: db, rdb: rdb, hub: hub, jwtSvc: jwtSvc}
+func NewHandler(db *pgxpool.Pool, rdb *redis.Client, hub *Hub, jwtSvc *auth.JWTService, tickets *auth.TicketStore) *Handler {
+	return &Handler{db: db, rdb: rdb, hub: hub, jwtSvc: jwtSvc, tickets: tickets}
 }
 
-func (h *Handler) WebSocket(w http.ResponseWriter, r *http.Request) {
+// IssueTicket mints a single-use ticket the client can pass as the ticket query
+// parameter when opening the WebSocket, instead of its access token.
+func (h *Handler) IssueTicket(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserID(r.Context())
-	sessionID := r.URL.Query().Get("session_id")
 
-	if sessionID == "" {
-		response.Error(w, http.StatusBadRequest, "session_id required")
+	ticket, err := h.tickets.Issue(r.Context(), userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to issue ticket")
 		return
 	}
 
-	// Verify user is part of this session
-	var count int
-	err := h.db.QueryRow(context.Background(),
-		`SELECT COUNT(*) FROM chat_sessions
-		 WHERE id = $1 AND (user1_id = $2 OR user2_id = $2) AND status = 'active'`,
-		sessionID, userID).Scan(&count)
-	if err != nil || count == 0 {
-		response.Error(w, http.StatusForbidden, "not authorized for this session")
-		return
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"ticket":     ticket,
+		"expires_in": int(h.tickets.TTL().Seconds()),
+	})
+}
+
+// WebSocket opens a connection that receives the user's events, such as
+// match_created, and with a session_id also joins that chat session.
+func (h *Handler) WebSocket(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+	sessionID := r.URL.Query().Get("session_id")
+
+	if sessionID != "" {
+		// Verify user is part of this revealed session
+		var count int
+		err := h.db.QueryRow(context.Background(),
+			`SELECT COUNT(*) FROM chat_sessions
+			 WHERE id = $1 AND (user1_id = $2 OR user2_id = $2) AND status IN ('active', 'connected')
+			   AND reveal_at <= NOW()`,
+			sessionID, userID).Scan(&count)
+		if err != nil || count == 0 {
+			response.Error(w, http.StatusForbidden, "not authorized for this session")
+			return
+		}
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -125,6 +144,7 @@ func (h *Handler) writePump(conn *websocket.Conn, client *Client) {
 			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+			h.hub.markPresent(client)
 		}
 	}
 }
@@ -145,7 +165,7 @@ func (h *Handler) GetMessages(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := h.db.Query(context.Background(),
-		`SELECT id, session_id, sender_id, content, created_at
+		`SELECT id, session_id, COALESCE(sender_id::text, ''), content, created_at
 		 FROM messages WHERE session_id = $1 ORDER BY created_at ASC`,
 		sessionID)
 	if err != nil {
@@ -174,12 +194,12 @@ func (h *Handler) EndChat(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserID(r.Context())
 	sessionID := chi.URLParam(r, "sessionId")
 
-	// Verify user is part of this active session
-	var user1, user2 string
+	// Verify user is part of this active session or connection
+	var user1, user2, status string
 	err := h.db.QueryRow(context.Background(),
-		`SELECT user1_id, user2_id FROM chat_sessions
-		 WHERE id = $1 AND status = 'active'`,
-		sessionID).Scan(&user1, &user2)
+		`SELECT user1_id, user2_id, status::text FROM chat_sessions
+		 WHERE id = $1 AND status IN ('active', 'connected')`,
+		sessionID).Scan(&user1, &user2, &status)
 	if err != nil {
 		response.Error(w, http.StatusNotFound, "active session not found")
 		return
@@ -190,21 +210,37 @@ func (h *Handler) EndChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.db.Exec(context.Background(),
-		`UPDATE chat_sessions SET status = 'ended_by_user', ended_at = NOW(), ended_by = $1
-		 WHERE id = $2`,
-		userID, sessionID)
+	// A connection ended before its night is over is scored now, because the
+	// scheduler only scores sessions that are still connected. scored_at is
+	// then set in the same statement, so it equals ended_at.
+	var scoreConnection bool
+	err = h.db.QueryRow(context.Background(),
+		`UPDATE chat_sessions SET status = 'ended_by_user', ended_at = NOW(), ended_by = $1,
+		        scored_at = CASE WHEN status = 'connected' AND ends_at > NOW() AND scored_at IS NULL
+		                         THEN NOW() ELSE scored_at END
+		 WHERE id = $2 AND status IN ('active', 'connected')
+		 RETURNING COALESCE(scored_at = ended_at, FALSE)`,
+		userID, sessionID).Scan(&scoreConnection)
 	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "failed to end chat")
 		return
 	}
 
-	// Record behavior events
-	h.hub.scoringSvc.RecordEndChat(context.Background(), userID, sessionID)
+	// Record behavior events and compute scores for both users. A
+	// connection whose night has been scored already is left alone.
+	if status == "active" {
+		h.hub.scoringSvc.RecordEndChat(context.Background(), userID, sessionID)
+	}
+	if status == "active" || scoreConnection {
+		h.hub.scoringSvc.ComputeSessionScore(context.Background(), user1, sessionID)
+		h.hub.scoringSvc.ComputeSessionScore(context.Background(), user2, sessionID)
+	}
 
-	// Compute scores for both users
-	h.hub.scoringSvc.ComputeSessionScore(context.Background(), user1, sessionID)
-	h.hub.scoringSvc.ComputeSessionScore(context.Background(), user2, sessionID)
+	partnerID := user1
+	if userID == user1 {
+		partnerID = user2
+	}
+	h.hub.notifications.PartnerEndedChat(context.Background(), partnerID, sessionID)
 
 	// Notify connected clients
 	endMsg := WSMessage{
@@ -11,20 +11,38 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 
+	"github.com/uniqsocial/backend/internal/matcher"
+	"github.com/uniqsocial/backend/internal/notify"
 	"github.com/uniqsocial/backend/internal/scoring"
 )
 
+// Redis channels fanning messages out to every instance: one for session
+// rooms and one for events addressed to a user.
+const (
+	roomChannel = "chat:messages"
+	userChannel = "chat:users"
+)
+
+// presenceTTL is how long a user counts as in a chat after their connection
+// was last seen alive. Connections refresh it on every ping.
+const presenceTTL = 75 * time.Second
+
 type Hub struct {
-	instanceID string
-	db         *pgxpool.Pool
-	rdb        *redis.Client
-	scoringSvc *scoring.Service
-	rooms      map[string]map[*Client]bool
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan *Envelope
+	instanceID    string
+	db            *pgxpool.Pool
+	rdb           *redis.Client
+	scoringSvc    *scoring.Service
+	notifications *notify.Service
+	rooms         map[string]map[*Client]bool
+	users         map[string]map[*Client]bool
+	register      chan *Client
+	unregister    chan *Client
+	broadcast     chan *Envelope
+	direct        chan *Envelope
 }
 
+// Client is one WebSocket connection. Every client receives its user's
+// events; clients with a SessionID also join that session's room.
 type Client struct {
 	UserID    string
 	SessionID string
@@ -32,10 +50,13 @@ type Client struct {
 	hub       *Hub
 }
 
+// Envelope carries data to a session room, or to every connection of UserID
+// when it is set.
 type Envelope struct {
-	SessionID  string `json:"session_id"`
+	SessionID  string `json:"session_id,omitempty"`
+	UserID     string `json:"user_id,omitempty"`
 	Data       []byte `json:"data"`
-	SenderID   string `json:"sender_id"`
+	SenderID   string `json:"sender_id,omitempty"`
 	InstanceID string `json:"instance_id,omitempty"`
 }
 
@@ -47,23 +68,27 @@ type WSMessage struct {
 	Timestamp string `json:"timestamp,omitempty"`
 }
 
-func NewHub(db *pgxpool.Pool, rdb *redis.Client, scoringSvc *scoring.Service) *Hub {
+func NewHub(db *pgxpool.Pool, rdb *redis.Client, scoringSvc *scoring.Service, notifications *notify.Service) *Hub {
 	return &Hub{
-		instanceID: fmt.Sprintf("hub-%d-%d", time.Now().UnixNano(), rand.Int63()),
-		db:         db,
-		rdb:        rdb,
-		scoringSvc: scoringSvc,
-		rooms:      make(map[string]map[*Client]bool),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan *Envelope, 256),
+		instanceID:    fmt.Sprintf("hub-%d-%d", time.Now().UnixNano(), rand.Int63()),
+		db:            db,
+		rdb:           rdb,
+		scoringSvc:    scoringSvc,
+		notifications: notifications,
+		rooms:         make(map[string]map[*Client]bool),
+		users:         make(map[string]map[*Client]bool),
+		register:      make(chan *Client),
+		unregister:    make(chan *Client),
+		broadcast:     make(chan *Envelope, 256),
+		direct:        make(chan *Envelope, 256),
 	}
 }
 
 func (h *Hub) Run() {
 	ctx := context.Background()
 
-	pubsub := h.rdb.Subscribe(ctx, "chat:messages")
+	pubsub := h.rdb.Subscribe(ctx, roomChannel, userChannel)
+	remote := make(chan *Envelope, 256)
 	go func() {
 		ch := pubsub.Channel()
 		for msg := range ch {
@@ -74,53 +99,167 @@ func (h *Hub) Run() {
 			if env.InstanceID == h.instanceID {
 				continue // Skip messages from our own instance (already delivered locally)
 			}
-			h.broadcastToRoom(env.SessionID, env.Data, env.SenderID)
+			remote <- &env
 		}
 	}()
 
 	for {
 		select {
 		case client := <-h.register:
-			if h.rooms[client.SessionID] == nil {
-				h.rooms[client.SessionID] = make(map[*Client]bool)
+			if h.users[client.UserID] == nil {
+				h.users[client.UserID] = make(map[*Client]bool)
+			}
+			h.users[client.UserID][client] = true
+			if client.SessionID != "" {
+				if h.rooms[client.SessionID] == nil {
+					h.rooms[client.SessionID] = make(map[*Client]bool)
+				}
+				h.rooms[client.SessionID][client] = true
+				h.markPresent(client)
+				log.Printf("chat: user %s joined session %s", client.UserID, client.SessionID)
 			}
-			h.rooms[client.SessionID][client] = true
-			log.Printf("chat: user %s joined session %s", client.UserID, client.SessionID)
 
 		case client := <-h.unregister:
-			if clients, ok := h.rooms[client.SessionID]; ok {
-				if _, ok := clients[client]; ok {
-					delete(clients, client)
-					close(client.Send)
-					if len(clients) == 0 {
-						delete(h.rooms, client.SessionID)
-					}
-				}
+			if h.drop(client) && client.SessionID != "" {
+				log.Printf("chat: user %s left session %s", client.UserID, client.SessionID)
 			}
-			log.Printf("chat: user %s left session %s", client.UserID, client.SessionID)
 
 		case env := <-h.broadcast:
-			h.broadcastToRoom(env.SessionID, env.Data, env.SenderID)
+			h.deliver(env)
 			env.InstanceID = h.instanceID
 			payload, _ := json.Marshal(env)
-			h.rdb.Publish(ctx, "chat:messages", payload)
+			h.rdb.Publish(ctx, roomChannel, payload)
+
+		case env := <-h.direct:
+			h.deliver(env)
+			env.InstanceID = h.instanceID
+			payload, _ := json.Marshal(env)
+			h.rdb.Publish(ctx, userChannel, payload)
+
+		case env := <-remote:
+			h.deliver(env)
 		}
 	}
 }
 
-func (h *Hub) broadcastToRoom(sessionID string, data []byte, senderID string) {
-	clients := h.rooms[sessionID]
+// deliver sends an envelope to the local clients it is addressed to.
+func (h *Hub) deliver(env *Envelope) {
+	clients := h.rooms[env.SessionID]
+	if env.UserID != "" {
+		clients = h.users[env.UserID]
+	}
 	for client := range clients {
 		select {
-		case client.Send <- data:
+		case client.Send <- env.Data:
 		default:
-			close(client.Send)
-			delete(clients, client)
+			h.drop(client)
+		}
+	}
+}
+
+// drop removes a client from its room and user and closes its Send channel,
+// reporting false if it was already gone.
+func (h *Hub) drop(client *Client) bool {
+	clients, ok := h.users[client.UserID]
+	if !ok || !clients[client] {
+		return false
+	}
+	delete(clients, client)
+	if len(clients) == 0 {
+		delete(h.users, client.UserID)
+	}
+	if room, ok := h.rooms[client.SessionID]; ok {
+		delete(room, client)
+		if len(room) == 0 {
+			delete(h.rooms, client.SessionID)
+		}
+		stillPresent := false
+		for other := range room {
+			stillPresent = stillPresent || other.UserID == client.UserID
 		}
+		if !stillPresent {
+			h.rdb.Del(context.Background(), presenceKey(client.SessionID, client.UserID))
+		}
+	}
+	close(client.Send)
+	return true
+}
+
+func presenceKey(sessionID, userID string) string {
+	return fmt.Sprintf("chat:present:%s:%s", sessionID, userID)
+}
+
+// markPresent records that a client's user is in its chat session, on this
+// or any other instance.
+func (h *Hub) markPresent(client *Client) {
+	if client.SessionID != "" {
+		h.rdb.Set(context.Background(), presenceKey(client.SessionID, client.UserID), 1, presenceTTL)
+	}
+}
+
+// notifyIfAway pushes a new-message notification to the sender's partner
+// unless they have the chat open.
+func (h *Hub) notifyIfAway(client *Client) {
+	ctx := context.Background()
+
+	var partnerID string
+	err := h.db.QueryRow(ctx,
+		`SELECT CASE WHEN user1_id = $2 THEN user2_id ELSE user1_id END
+		 FROM chat_sessions WHERE id = $1`,
+		client.SessionID, client.UserID).Scan(&partnerID)
+	if err != nil {
+		return
+	}
+
+	if h.rdb.Exists(ctx, presenceKey(client.SessionID, partnerID)).Val() == 0 {
+		h.notifications.NewMessage(ctx, partnerID, client.SessionID)
+	}
+}
+
+// SendToUser delivers a message to every open connection of a user, on any
+// instance.
+func (h *Hub) SendToUser(userID string, msg WSMessage) {
+	data, _ := json.Marshal(msg)
+	h.direct <- &Envelope{UserID: userID, Data: data}
+}
+
+// WindowClosing warns a session's room that the chat is about to end.
+func (h *Hub) WindowClosing(ctx context.Context, e matcher.WindowClosing) {
+	data, _ := json.Marshal(WSMessage{
+		Type:      "window_closing",
+		SessionID: e.SessionID,
+		Timestamp: e.EndsAt.UTC().Format(time.RFC3339),
+	})
+	h.broadcast <- &Envelope{SessionID: e.SessionID, Data: data}
+}
+
+// MatchSkipped tells a session's room that the match was skipped.
+func (h *Hub) MatchSkipped(ctx context.Context, e matcher.MatchSkipped) {
+	data, _ := json.Marshal(WSMessage{
+		Type:      "match_skipped",
+		SessionID: e.SessionID,
+		SenderID:  e.SkippedBy,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+	h.broadcast <- &Envelope{SessionID: e.SessionID, Data: data, SenderID: e.SkippedBy}
+}
+
+// MatchCreated tells both users about their new match.
+func (h *Hub) MatchCreated(ctx context.Context, e matcher.MatchCreated) {
+	for _, userID := range e.UserIDs {
+		h.SendToUser(userID, WSMessage{
+			Type:      "match_created",
+			SessionID: e.SessionID,
+			Timestamp: e.RevealAt.UTC().Format(time.RFC3339),
+		})
 	}
 }
 
 func (h *Hub) HandleMessage(client *Client, raw []byte) {
+	if client.SessionID == "" {
+		return // Event-only connections cannot send
+	}
+
 	var msg WSMessage
 	if err := json.Unmarshal(raw, &msg); err != nil {
 		return
@@ -132,8 +271,11 @@ func (h *Hub) HandleMessage(client *Client, raw []byte) {
 
 	switch msg.Type {
 	case "message":
-		h.persistMessage(client, msg)
+		if !h.persistMessage(client, msg) {
+			return
+		}
 		h.trackReplyBehavior(client, msg)
+		h.notifyIfAway(client)
 	case "typing":
 		// No persistence needed
 	}
@@ -146,14 +288,21 @@ func (h *Hub) HandleMessage(client *Client, raw []byte) {
 	}
 }
 
-func (h *Hub) persistMessage(client *Client, msg WSMessage) {
+// persistMessage stores a message, reporting false if it was not stored
+// because the session is no longer open, such as after a skip or once the
+// chat has ended, even though the sender is still connected to its room.
+func (h *Hub) persistMessage(client *Client, msg WSMessage) bool {
 	ctx := context.Background()
-	_, err := h.db.Exec(ctx,
-		`INSERT INTO messages (session_id, sender_id, content) VALUES ($1, $2, $3)`,
+	tag, err := h.db.Exec(ctx,
+		`INSERT INTO messages (session_id, sender_id, content)
+		 SELECT $1, $2, $3 FROM chat_sessions
+		 WHERE id = $1 AND status IN ('active', 'connected')`,
 		client.SessionID, client.UserID, msg.Content)
 	if err != nil {
 		log.Printf("chat: persist message: %v", err)
+		return false
 	}
+	return tag.RowsAffected() == 1
 }
 
 func (h *Hub) trackReplyBehavior(client *Client, msg WSMessage) {
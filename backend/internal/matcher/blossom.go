@@ -0,0 +1,564 @@
+package matcher
+
+// maxWeightMatching computes a maximum-weight matching of a general graph
+// with Edmonds' blossom algorithm, using the primal-dual formulation of Galil
+// ("Efficient algorithms for finding maximum matching in graphs", 1986). It
+// runs in O(n³) time.
+//
+// Weights are integers so that all dual variables stay exact. The result maps
+// each vertex to its partner, or -1 if it is unmatched.
+func maxWeightMatching(nvertex int, edges []weightedEdge) []int {
+	mate := make([]int, nvertex)
+	for i := range mate {
+		mate[i] = -1
+	}
+	if len(edges) == 0 {
+		return mate
+	}
+
+	nedge := len(edges)
+
+	var maxWeight int64
+	for _, e := range edges {
+		if e.weight > maxWeight {
+			maxWeight = e.weight
+		}
+	}
+
+	// endpoint[p] is the vertex at end p of edge p/2; neighbend[v] lists the
+	// remote endpoints of the edges incident to v.
+	endpoint := make([]int, 2*nedge)
+	neighbend := make([][]int, nvertex)
+	for k, e := range edges {
+		endpoint[2*k] = e.u
+		endpoint[2*k+1] = e.v
+		neighbend[e.u] = append(neighbend[e.u], 2*k+1)
+		neighbend[e.v] = append(neighbend[e.v], 2*k)
+	}
+
+	// mate holds remote endpoints while the algorithm runs and is translated
+	// to vertices at the end.
+	label := make([]int, 2*nvertex)
+	labelend := filled(2*nvertex, -1)
+	inblossom := make([]int, nvertex)
+	for i := range inblossom {
+		inblossom[i] = i
+	}
+	blossomparent := filled(2*nvertex, -1)
+	blossomchilds := make([][]int, 2*nvertex)
+	blossombase := filled(2*nvertex, -1)
+	for i := 0; i < nvertex; i++ {
+		blossombase[i] = i
+	}
+	blossomendps := make([][]int, 2*nvertex)
+	bestedge := filled(2*nvertex, -1)
+	blossombestedges := make([][]int, 2*nvertex)
+	unusedblossoms := make([]int, 0, nvertex)
+	for b := nvertex; b < 2*nvertex; b++ {
+		unusedblossoms = append(unusedblossoms, b)
+	}
+	dualvar := make([]int64, 2*nvertex)
+	for i := 0; i < nvertex; i++ {
+		dualvar[i] = maxWeight
+	}
+	allowedge := make([]bool, nedge)
+	var queue []int
+
+	slack := func(k int) int64 {
+		e := edges[k]
+		return dualvar[e.u] + dualvar[e.v] - 2*e.weight
+	}
+
+	var blossomLeaves func(b int, out []int) []int
+	blossomLeaves = func(b int, out []int) []int {
+		if b < nvertex {
+			return append(out, b)
+		}
+		for _, t := range blossomchilds[b] {
+			out = blossomLeaves(t, out)
+		}
+		return out
+	}
+
+	// assignLabel labels the top-level blossom containing w with t (1 for S,
+	// 2 for T), reached through endpoint p.
+	var assignLabel func(w, t, p int)
+	assignLabel = func(w, t, p int) {
+		b := inblossom[w]
+		label[w], label[b] = t, t
+		labelend[w], labelend[b] = p, p
+		bestedge[w], bestedge[b] = -1, -1
+		if t == 1 {
+			queue = blossomLeaves(b, queue)
+		} else if t == 2 {
+			base := blossombase[b]
+			assignLabel(endpoint[mate[base]], 1, mate[base]^1)
+		}
+	}
+
+	// scanBlossom traces back from v and w to find either a new blossom (its
+	// base is returned) or an augmenting path (-1 is returned).
+	scanBlossom := func(v, w int) int {
+		var path []int
+		base := -1
+		for v != -1 || w != -1 {
+			b := inblossom[v]
+			if label[b]&4 != 0 {
+				base = blossombase[b]
+				break
+			}
+			path = append(path, b)
+			label[b] = 5
+			if labelend[b] == -1 {
+				v = -1
+			} else {
+				v = endpoint[labelend[b]]
+				b = inblossom[v]
+				v = endpoint[labelend[b]]
+			}
+			if w != -1 {
+				v, w = w, v
+			}
+		}
+		for _, b := range path {
+			label[b] = 1
+		}
+		return base
+	}
+
+	addBlossom := func(base, k int) {
+		v, w := edges[k].u, edges[k].v
+		bb := inblossom[base]
+		bv := inblossom[v]
+		bw := inblossom[w]
+
+		b := unusedblossoms[len(unusedblossoms)-1]
+		unusedblossoms = unusedblossoms[:len(unusedblossoms)-1]
+		blossombase[b] = base
+		blossomparent[b] = -1
+		blossomparent[bb] = b
+
+		var path, endps []int
+		for bv != bb {
+			blossomparent[bv] = b
+			path = append(path, bv)
+			endps = append(endps, labelend[bv])
+			v = endpoint[labelend[bv]]
+			bv = inblossom[v]
+		}
+		path = append(path, bb)
+		reverse(path)
+		reverse(endps)
+		endps = append(endps, 2*k)
+		for bw != bb {
+			blossomparent[bw] = b
+			path = append(path, bw)
+			endps = append(endps, labelend[bw]^1)
+			w = endpoint[labelend[bw]]
+			bw = inblossom[w]
+		}
+		blossomchilds[b] = path
+		blossomendps[b] = endps
+
+		label[b] = 1
+		labelend[b] = labelend[bb]
+		dualvar[b] = 0
+		for _, leaf := range blossomLeaves(b, nil) {
+			if label[inblossom[leaf]] == 2 {
+				// Former T-vertices become S-vertices and must be scanned
+				queue = append(queue, leaf)
+			}
+			inblossom[leaf] = b
+		}
+
+		// Compute the least-slack edges from the new blossom to each
+		// neighbouring S-blossom.
+		bestedgeto := filled(2*nvertex, -1)
+		for _, sub := range path {
+			var nblists [][]int
+			if blossombestedges[sub] == nil {
+				for _, leaf := range blossomLeaves(sub, nil) {
+					ks := make([]int, len(neighbend[leaf]))
+					for i, p := range neighbend[leaf] {
+						ks[i] = p / 2
+					}
+					nblists = append(nblists, ks)
+				}
+			} else {
+				nblists = [][]int{blossombestedges[sub]}
+			}
+			for _, nblist := range nblists {
+				for _, k := range nblist {
+					j := edges[k].v
+					if inblossom[j] == b {
+						j = edges[k].u
+					}
+					bj := inblossom[j]
+					if bj != b && label[bj] == 1 &&
+						(bestedgeto[bj] == -1 || slack(k) < slack(bestedgeto[bj])) {
+						bestedgeto[bj] = k
+					}
+				}
+			}
+			blossombestedges[sub] = nil
+			bestedge[sub] = -1
+		}
+		var best []int
+		for _, k := range bestedgeto {
+			if k != -1 {
+				best = append(best, k)
+			}
+		}
+		blossombestedges[b] = best
+		bestedge[b] = -1
+		for _, k := range best {
+			if bestedge[b] == -1 || slack(k) < slack(bestedge[b]) {
+				bestedge[b] = k
+			}
+		}
+	}
+
+	var expandBlossom func(b int, endstage bool)
+	expandBlossom = func(b int, endstage bool) {
+		for _, s := range blossomchilds[b] {
+			blossomparent[s] = -1
+			if s < nvertex {
+				inblossom[s] = s
+			} else if endstage && dualvar[s] == 0 {
+				expandBlossom(s, endstage)
+			} else {
+				for _, leaf := range blossomLeaves(s, nil) {
+					inblossom[leaf] = s
+				}
+			}
+		}
+
+		if !endstage && label[b] == 2 {
+			// Relabel the sub-blossoms on the even-length path from the
+			// entry child to the base.
+			childs := blossomchilds[b]
+			endps := blossomendps[b]
+			at := func(j int) int { return childs[index(j, len(childs))] }
+			endpAt := func(j int) int { return endps[index(j, len(endps))] }
+
+			entrychild := inblossom[endpoint[labelend[b]^1]]
+			j := indexOf(childs, entrychild)
+			var jstep, endptrick int
+			if j&1 != 0 {
+				j -= len(childs)
+				jstep = 1
+				endptrick = 0
+			} else {
+				jstep = -1
+				endptrick = 1
+			}
+			p := labelend[b]
+			for j != 0 {
+				label[endpoint[p^1]] = 0
+				label[endpoint[endpAt(j-endptrick)^endptrick^1]] = 0
+				assignLabel(endpoint[p^1], 2, p)
+				allowedge[endpAt(j-endptrick)/2] = true
+				j += jstep
+				p = endpAt(j-endptrick) ^ endptrick
+				allowedge[p/2] = true
+				j += jstep
+			}
+			bv := at(j)
+			label[endpoint[p^1]], label[bv] = 2, 2
+			labelend[endpoint[p^1]], labelend[bv] = p, p
+			bestedge[bv] = -1
+			j += jstep
+			for at(j) != entrychild {
+				bv = at(j)
+				if label[bv] == 1 {
+					j += jstep
+					continue
+				}
+				leaves := blossomLeaves(bv, nil)
+				v := leaves[len(leaves)-1]
+				for _, leaf := range leaves {
+					if label[leaf] != 0 {
+						v = leaf
+						break
+					}
+				}
+				if label[v] != 0 {
+					label[v] = 0
+					label[endpoint[mate[blossombase[bv]]]] = 0
+					assignLabel(v, 2, labelend[v])
+				}
+				j += jstep
+			}
+		}
+
+		label[b], labelend[b] = -1, -1
+		blossomchilds[b], blossomendps[b] = nil, nil
+		blossombase[b] = -1
+		blossombestedges[b] = nil
+		bestedge[b] = -1
+		unusedblossoms = append(unusedblossoms, b)
+	}
+
+	// augmentBlossom swaps matched and unmatched edges along the path from
+	// vertex v to the base of blossom b, making v the new base.
+	var augmentBlossom func(b, v int)
+	augmentBlossom = func(b, v int) {
+		t := v
+		for blossomparent[t] != b {
+			t = blossomparent[t]
+		}
+		if t >= nvertex {
+			augmentBlossom(t, v)
+		}
+		childs := blossomchilds[b]
+		endps := blossomendps[b]
+		i := indexOf(childs, t)
+		j := i
+		var jstep, endptrick int
+		if i&1 != 0 {
+			j -= len(childs)
+			jstep = 1
+			endptrick = 0
+		} else {
+			jstep = -1
+			endptrick = 1
+		}
+		for j != 0 {
+			j += jstep
+			t = childs[index(j, len(childs))]
+			p := endps[index(j-endptrick, len(endps))] ^ endptrick
+			if t >= nvertex {
+				augmentBlossom(t, endpoint[p])
+			}
+			j += jstep
+			t = childs[index(j, len(childs))]
+			if t >= nvertex {
+				augmentBlossom(t, endpoint[p^1])
+			}
+			mate[endpoint[p]] = p ^ 1
+			mate[endpoint[p^1]] = p
+		}
+		blossomchilds[b] = append(append([]int{}, childs[i:]...), childs[:i]...)
+		blossomendps[b] = append(append([]int{}, endps[i:]...), endps[:i]...)
+		blossombase[b] = blossombase[blossomchilds[b][0]]
+	}
+
+	augmentMatching := func(k int) {
+		for _, sp := range [2][2]int{{edges[k].u, 2*k + 1}, {edges[k].v, 2 * k}} {
+			s, p := sp[0], sp[1]
+			for {
+				bs := inblossom[s]
+				if bs >= nvertex {
+					augmentBlossom(bs, s)
+				}
+				mate[s] = p
+				if labelend[bs] == -1 {
+					break
+				}
+				t := endpoint[labelend[bs]]
+				bt := inblossom[t]
+				s = endpoint[labelend[bt]]
+				j := endpoint[labelend[bt]^1]
+				if bt >= nvertex {
+					augmentBlossom(bt, j)
+				}
+				mate[j] = labelend[bt]
+				p = labelend[bt] ^ 1
+			}
+		}
+	}
+
+	for stage := 0; stage < nvertex; stage++ {
+		for i := range label {
+			label[i] = 0
+			bestedge[i] = -1
+		}
+		for b := nvertex; b < 2*nvertex; b++ {
+			blossombestedges[b] = nil
+		}
+		for k := range allowedge {
+			allowedge[k] = false
+		}
+		queue = queue[:0]
+
+		for v := 0; v < nvertex; v++ {
+			if mate[v] == -1 && label[inblossom[v]] == 0 {
+				assignLabel(v, 1, -1)
+			}
+		}
+
+		augmented := false
+		for {
+			for len(queue) > 0 && !augmented {
+				v := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+
+				for _, p := range neighbend[v] {
+					k := p / 2
+					w := endpoint[p]
+					if inblossom[v] == inblossom[w] {
+						continue
+					}
+					var kslack int64
+					if !allowedge[k] {
+						kslack = slack(k)
+						if kslack <= 0 {
+							allowedge[k] = true
+						}
+					}
+					if allowedge[k] {
+						if label[inblossom[w]] == 0 {
+							assignLabel(w, 2, p^1)
+						} else if label[inblossom[w]] == 1 {
+							base := scanBlossom(v, w)
+							if base >= 0 {
+								addBlossom(base, k)
+							} else {
+								augmentMatching(k)
+								augmented = true
+								break
+							}
+						} else if label[w] == 0 {
+							label[w] = 2
+							labelend[w] = p ^ 1
+						}
+					} else if label[inblossom[w]] == 1 {
+						b := inblossom[v]
+						if bestedge[b] == -1 || kslack < slack(bestedge[b]) {
+							bestedge[b] = k
+						}
+					} else if label[w] == 0 {
+						if bestedge[w] == -1 || kslack < slack(bestedge[w]) {
+							bestedge[w] = k
+						}
+					}
+				}
+			}
+			if augmented {
+				break
+			}
+
+			// No augmenting path under the current duals; find the largest
+			// dual update that keeps them feasible.
+			deltatype := 1
+			delta := dualvar[0]
+			for v := 1; v < nvertex; v++ {
+				if dualvar[v] < delta {
+					delta = dualvar[v]
+				}
+			}
+			deltaedge, deltablossom := -1, -1
+			for v := 0; v < nvertex; v++ {
+				if label[inblossom[v]] == 0 && bestedge[v] != -1 {
+					if d := slack(bestedge[v]); d < delta {
+						delta = d
+						deltatype = 2
+						deltaedge = bestedge[v]
+					}
+				}
+			}
+			for b := 0; b < 2*nvertex; b++ {
+				if blossomparent[b] == -1 && label[b] == 1 && bestedge[b] != -1 {
+					if d := slack(bestedge[b]) / 2; d < delta {
+						delta = d
+						deltatype = 3
+						deltaedge = bestedge[b]
+					}
+				}
+			}
+			for b := nvertex; b < 2*nvertex; b++ {
+				if blossombase[b] >= 0 && blossomparent[b] == -1 && label[b] == 2 && dualvar[b] < delta {
+					delta = dualvar[b]
+					deltatype = 4
+					deltablossom = b
+				}
+			}
+
+			for v := 0; v < nvertex; v++ {
+				switch label[inblossom[v]] {
+				case 1:
+					dualvar[v] -= delta
+				case 2:
+					dualvar[v] += delta
+				}
+			}
+			for b := nvertex; b < 2*nvertex; b++ {
+				if blossombase[b] >= 0 && blossomparent[b] == -1 {
+					switch label[b] {
+					case 1:
+						dualvar[b] += delta
+					case 2:
+						dualvar[b] -= delta
+					}
+				}
+			}
+
+			if deltatype == 1 {
+				// Optimum reached
+				break
+			} else if deltatype == 2 {
+				allowedge[deltaedge] = true
+				i := edges[deltaedge].u
+				if label[inblossom[i]] == 0 {
+					i = edges[deltaedge].v
+				}
+				queue = append(queue, i)
+			} else if deltatype == 3 {
+				allowedge[deltaedge] = true
+				queue = append(queue, edges[deltaedge].u)
+			} else {
+				expandBlossom(deltablossom, false)
+			}
+		}
+
+		if !augmented {
+			break
+		}
+
+		// Expand S-blossoms whose dual dropped to zero
+		for b := nvertex; b < 2*nvertex; b++ {
+			if blossomparent[b] == -1 && blossombase[b] >= 0 && label[b] == 1 && dualvar[b] == 0 {
+				expandBlossom(b, true)
+			}
+		}
+	}
+
+	for v := range mate {
+		if mate[v] >= 0 {
+			mate[v] = endpoint[mate[v]]
+		}
+	}
+	return mate
+}
+
+func filled(n, value int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = value
+	}
+	return s
+}
+
+func reverse(s []int) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+func indexOf(s []int, v int) int {
+	for i, x := range s {
+		if x == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// index maps a possibly negative position onto a slice of length n, the way
+// Python indexing does.
+func index(j, n int) int {
+	if j < 0 {
+		return j + n
+	}
+	return j
+}
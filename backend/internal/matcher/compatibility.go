@@ -0,0 +1,188 @@
+package matcher
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Traits are the profile answers compared when scoring how compatible two
+// users are.
+type Traits struct {
+	Interests             []string
+	LookingFor            []string
+	CurrentlyInterestedIn []string
+	EnergyLevel           string
+	SocialStyle           string
+	SleepSchedule         string
+	Drinking              string
+	FitnessLevel          string
+}
+
+// traitColumns selects Traits for the user aliased u, with their profile
+// joined as up. Scan them with Traits.scanDest.
+const traitColumns = `COALESCE(u.interests, '[]'::jsonb),
+		        COALESCE(up.looking_for, '[]'::jsonb), COALESCE(up.currently_interested_in, '[]'::jsonb),
+		        COALESCE(up.energy_level, ''), COALESCE(up.social_style, ''), COALESCE(up.sleep_schedule, ''),
+		        COALESCE(up.drinking, ''), COALESCE(up.fitness_level, '')`
+
+func (t *Traits) scanDest() []interface{} {
+	return []interface{}{
+		&t.Interests, &t.LookingFor, &t.CurrentlyInterestedIn,
+		&t.EnergyLevel, &t.SocialStyle, &t.SleepSchedule, &t.Drinking, &t.FitnessLevel,
+	}
+}
+
+// CompatibilityScorer rates how well two users' traits fit together, from 0
+// (nothing in common) to 1.
+type CompatibilityScorer interface {
+	Compatibility(a, b *Traits) float64
+}
+
+// DefaultTraitWeights weighs every trait equally.
+var DefaultTraitWeights = map[string]float64{
+	"interests":               1,
+	"looking_for":             1,
+	"currently_interested_in": 1,
+	"energy_level":            1,
+	"social_style":            1,
+	"sleep_schedule":          1,
+	"drinking":                1,
+	"fitness_level":           1,
+}
+
+// TraitWeightsWith returns DefaultTraitWeights with the given weights in place
+// of the defaults they name. Names that are not traits are an error.
+func TraitWeightsWith(overrides map[string]float64) (map[string]float64, error) {
+	weights := make(map[string]float64, len(DefaultTraitWeights))
+	for name, w := range DefaultTraitWeights {
+		weights[name] = w
+	}
+	for name, w := range overrides {
+		if _, ok := weights[name]; !ok {
+			return nil, fmt.Errorf("unknown trait %q", name)
+		}
+		weights[name] = w
+	}
+	return weights, nil
+}
+
+// Ordinal scales for the single-choice profile answers, in order. The values
+// are what the onboarding screens store.
+var (
+	energyLevels   = []string{"introvert", "ambivert", "extrovert"}
+	socialStyles   = []string{"1-on-1", "small_group", "large_group"}
+	sleepSchedules = []string{"early_bird", "night_owl"}
+	drinkingLevels = []string{"no", "occasionally", "yes"}
+	fitnessLevels  = []string{"low", "moderate", "active"}
+)
+
+// TraitScorer is the default CompatibilityScorer. It takes the Jaccard
+// similarity of list traits and the ordinal closeness of single-choice
+// traits, and averages them by weight. Traits either user has left blank are
+// skipped; users with nothing comparable score a neutral 0.5.
+type TraitScorer struct {
+	weights map[string]float64
+}
+
+// NewTraitScorer returns a TraitScorer with weights keyed like
+// DefaultTraitWeights. Traits without a weight are ignored.
+func NewTraitScorer(weights map[string]float64) *TraitScorer {
+	return &TraitScorer{weights: weights}
+}
+
+func (s *TraitScorer) Compatibility(a, b *Traits) float64 {
+	var total, weight float64
+	for name, w := range s.weights {
+		similarity, ok := traitSimilarity(name, a, b)
+		if !ok || w <= 0 {
+			continue
+		}
+		total += w * similarity
+		weight += w
+	}
+
+	if weight == 0 {
+		return 0.5
+	}
+	return total / weight
+}
+
+// traitSimilarity compares one named trait, reporting false when it is
+// unknown or cannot be compared.
+func traitSimilarity(name string, a, b *Traits) (float64, bool) {
+	switch name {
+	case "interests":
+		return jaccard(a.Interests, b.Interests)
+	case "looking_for":
+		return jaccard(a.LookingFor, b.LookingFor)
+	case "currently_interested_in":
+		return jaccard(a.CurrentlyInterestedIn, b.CurrentlyInterestedIn)
+	case "energy_level":
+		return ordinal(energyLevels, a.EnergyLevel, b.EnergyLevel)
+	case "social_style":
+		return ordinal(socialStyles, a.SocialStyle, b.SocialStyle)
+	case "sleep_schedule":
+		return ordinal(sleepSchedules, a.SleepSchedule, b.SleepSchedule)
+	case "drinking":
+		return ordinal(drinkingLevels, a.Drinking, b.Drinking)
+	case "fitness_level":
+		return ordinal(fitnessLevels, a.FitnessLevel, b.FitnessLevel)
+	}
+	return 0, false
+}
+
+// jaccard returns |a∩b| / |a∪b|, comparing case-insensitively. It reports
+// false if either list is empty.
+func jaccard(a, b []string) (float64, bool) {
+	if len(a) == 0 || len(b) == 0 {
+		return 0, false
+	}
+	set := make(map[string]bool, len(a))
+	for _, v := range a {
+		set[normalizeTrait(v)] = true
+	}
+	union := len(set)
+	var shared int
+	seen := make(map[string]bool, len(b))
+	for _, v := range b {
+		v = normalizeTrait(v)
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		if set[v] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	return float64(shared) / float64(union), true
+}
+
+// ordinal returns 1 for equal answers, falling linearly to 0 for opposite
+// ends of scale. It reports false if either answer is not on the scale.
+func ordinal(scale []string, a, b string) (float64, bool) {
+	i, j := indexOfTrait(scale, a), indexOfTrait(scale, b)
+	if i < 0 || j < 0 {
+		return 0, false
+	}
+	d := i - j
+	if d < 0 {
+		d = -d
+	}
+	return 1 - float64(d)/float64(len(scale)-1), true
+}
+
+func indexOfTrait(scale []string, v string) int {
+	v = normalizeTrait(v)
+	for i, s := range scale {
+		if s == v {
+			return i
+		}
+	}
+	return -1
+}
+
+func normalizeTrait(v string) string {
+	return strings.ToLower(strings.TrimSpace(v))
+}
@@ -0,0 +1,150 @@
+package matcher
+
+import (
+	"math"
+	"testing"
+)
+
+func TestJaccard(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   []string
+		want   float64
+		wantOK bool
+	}{
+		{"both nil", nil, nil, 0, false},
+		{"one nil", nil, []string{"music"}, 0, false},
+		{"one empty", []string{"music"}, []string{}, 0, false},
+		{"identical", []string{"music", "art"}, []string{"art", "music"}, 1, true},
+		{"disjoint", []string{"music"}, []string{"art"}, 0, true},
+		{"partial overlap", []string{"music", "art"}, []string{"art", "film"}, 1.0 / 3, true},
+		{"case and spaces", []string{"Music "}, []string{" music"}, 1, true},
+		{"duplicates", []string{"music", "music"}, []string{"music", "MUSIC", "art"}, 0.5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := jaccard(tt.a, tt.b)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("jaccard = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestOrdinal(t *testing.T) {
+	tests := []struct {
+		name   string
+		scale  []string
+		a, b   string
+		want   float64
+		wantOK bool
+	}{
+		{"equal", energyLevels, "ambivert", "ambivert", 1, true},
+		{"one step apart", energyLevels, "introvert", "ambivert", 0.5, true},
+		{"opposite ends", energyLevels, "extrovert", "introvert", 0, true},
+		{"two-point scale", sleepSchedules, "early_bird", "night_owl", 0, true},
+		{"case and spaces", drinkingLevels, " Occasionally", "occasionally ", 1, true},
+		{"not on the scale", energyLevels, "introvert", "shy", 0, false},
+		{"blank", fitnessLevels, "", "active", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ordinal(tt.scale, tt.a, tt.b)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("ordinal = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTraitScorer(t *testing.T) {
+	full := Traits{
+		Interests:   []string{"music", "art"},
+		EnergyLevel: "introvert",
+		Drinking:    "no",
+	}
+	tests := []struct {
+		name    string
+		weights map[string]float64
+		a, b    Traits
+		want    float64
+	}{
+		{
+			name:    "nothing comparable",
+			weights: DefaultTraitWeights,
+			a:       Traits{},
+			b:       full,
+			want:    0.5,
+		},
+		{
+			// Interests match fully; the traits b left blank are skipped
+			name:    "one side missing",
+			weights: DefaultTraitWeights,
+			a:       full,
+			b:       Traits{Interests: []string{"art", "music"}},
+			want:    1,
+		},
+		{
+			// interests 1/3, energy 0, drinking 1
+			name:    "equal weights",
+			weights: DefaultTraitWeights,
+			a:       full,
+			b:       Traits{Interests: []string{"art", "film"}, EnergyLevel: "extrovert", Drinking: "no"},
+			want:    (1.0/3 + 0 + 1) / 3,
+		},
+		{
+			name:    "overridden weights",
+			weights: map[string]float64{"interests": 3, "energy_level": 1, "drinking": 0},
+			a:       full,
+			b:       Traits{Interests: []string{"art", "film"}, EnergyLevel: "extrovert", Drinking: "no"},
+			want:    (3*(1.0/3) + 0) / 4,
+		},
+		{
+			name:    "unknown trait weight",
+			weights: map[string]float64{"interests": 1, "star_sign": 5},
+			a:       full,
+			b:       full,
+			want:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewTraitScorer(tt.weights)
+			if got := s.Compatibility(&tt.a, &tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Compatibility(a, b) = %v, want %v", got, tt.want)
+			}
+			if got := s.Compatibility(&tt.b, &tt.a); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Compatibility(b, a) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraitWeightsWith(t *testing.T) {
+	weights, err := TraitWeightsWith(map[string]float64{"interests": 3, "drinking": 0})
+	if err != nil {
+		t.Fatalf("TraitWeightsWith: %v", err)
+	}
+	for name, def := range DefaultTraitWeights {
+		want := def
+		switch name {
+		case "interests":
+			want = 3
+		case "drinking":
+			want = 0
+		}
+		if weights[name] != want {
+			t.Errorf("weight of %s = %v, want %v", name, weights[name], want)
+		}
+	}
+	if DefaultTraitWeights["interests"] != 1 {
+		t.Error("overrides changed DefaultTraitWeights")
+	}
+
+	if _, err := TraitWeightsWith(map[string]float64{"star_sign": 1}); err == nil {
+		t.Error("unknown trait accepted")
+	}
+}
@@ -0,0 +1,87 @@
+package matcher
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultRadiusStepsKm are the search radii tried in turn when
+// Config.RadiusStepsKm is not set.
+var DefaultRadiusStepsKm = []float64{50, 100, 250}
+
+// Config controls how the matcher finds, scores and pairs users.
+type Config struct {
+	Strategy      string
+	ExactMaxUsers int
+
+	// RematchCooldownDays is how long two users must wait before being
+	// matched again: 0 allows it any time, RematchNever never.
+	RematchCooldownDays int
+
+	// RadiusStepsKm are increasing search radii. Matching tries the first
+	// and only widens to the next for users still without a partner, up to
+	// each user's own max_distance_km.
+	RadiusStepsKm []float64
+
+	// ActiveWindow is how recently a user who opted in for tonight must
+	// have been seen to be matched.
+	ActiveWindow time.Duration
+
+	// RevealDelay holds back batch matches so that a whole cohort's matches
+	// are revealed at the same moment, this long after the batch starts.
+	RevealDelay time.Duration
+
+	// SkipsPerDay is how many matches a user may skip in one local day;
+	// 0 turns skipping off.
+	SkipsPerDay int
+
+	// Ranker turns pair features into priorities and defaults to a
+	// WeightedRanker with DefaultPriorityWeights. Compatibility scores
+	// profile traits and defaults to a TraitScorer with DefaultTraitWeights.
+	Ranker        Ranker
+	Compatibility CompatibilityScorer
+}
+
+func (c Config) withDefaults() Config {
+	if len(c.RadiusStepsKm) == 0 {
+		c.RadiusStepsKm = DefaultRadiusStepsKm
+	}
+	if c.ActiveWindow <= 0 {
+		c.ActiveWindow = DefaultActiveWindow
+	}
+	if c.Ranker == nil {
+		c.Ranker = WeightedRanker{Weights: DefaultPriorityWeights}
+	}
+	if c.Compatibility == nil {
+		c.Compatibility = NewTraitScorer(DefaultTraitWeights)
+	}
+	return c
+}
+
+// radiusSteps returns the search radii for a user, capped at their
+// max_distance_km if they set one lower than the widest step.
+func (c Config) radiusSteps(prefs *Preferences) []float64 {
+	if prefs.MaxDistanceKm == nil {
+		return c.RadiusStepsKm
+	}
+	ceiling := *prefs.MaxDistanceKm
+	var steps []float64
+	for _, r := range c.RadiusStepsKm {
+		if r >= ceiling {
+			return append(steps, ceiling)
+		}
+		steps = append(steps, r)
+	}
+	return steps
+}
+
+// priority ranks a pair of users dist km apart, found within radius km.
+func (c Config) priority(a, b *candidate, dist, radius float64) float64 {
+	return c.Ranker.Rank(Features{
+		DistanceKm:    dist,
+		Proximity:     1.0 - dist/radius,
+		Engagement:    1.0 - math.Abs(a.Score-b.Score)/100.0,
+		Compatibility: c.Compatibility.Compatibility(&a.Traits, &b.Traits),
+		Reception:     (a.Reception + b.Reception) / 2,
+	})
+}
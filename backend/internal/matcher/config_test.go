@@ -0,0 +1,30 @@
+package matcher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRadiusSteps(t *testing.T) {
+	cfg := Config{RadiusStepsKm: []float64{50, 100, 250}}
+	tests := []struct {
+		name          string
+		maxDistanceKm *float64
+		want          []float64
+	}{
+		{"no limit", nil, []float64{50, 100, 250}},
+		{"below the first step", floatPtr(20), []float64{20}},
+		{"between steps", floatPtr(150), []float64{50, 100, 150}},
+		{"on a step", floatPtr(100), []float64{50, 100}},
+		{"beyond the widest step", floatPtr(400), []float64{50, 100, 250}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cfg.radiusSteps(&Preferences{MaxDistanceKm: tt.maxDistanceKm})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("radiusSteps = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package matcher
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// MatchCreated is emitted once a match is revealed to its two users.
+type MatchCreated struct {
+	SessionID string
+	UserIDs   [2]string
+	RevealAt  time.Time
+}
+
+// WindowClosing is emitted once, shortly before an active session ends.
+type WindowClosing struct {
+	SessionID string
+	UserIDs   [2]string
+	EndsAt    time.Time
+}
+
+// MatchSkipped is emitted when one of a session's users skips the match.
+type MatchSkipped struct {
+	SessionID string
+	UserIDs   [2]string
+	SkippedBy string
+}
+
+// closingNotice is how long before a session ends WindowClosing is emitted.
+const closingNotice = 30 * time.Minute
+
+// EventPublisher delivers matcher domain events, for example to the users'
+// open WebSockets or their devices.
+type EventPublisher interface {
+	MatchCreated(ctx context.Context, e MatchCreated)
+	WindowClosing(ctx context.Context, e WindowClosing)
+	MatchSkipped(ctx context.Context, e MatchSkipped)
+}
+
+// Publishers hands every event to each of its publishers in turn.
+type Publishers []EventPublisher
+
+func (p Publishers) MatchCreated(ctx context.Context, e MatchCreated) {
+	for _, pub := range p {
+		pub.MatchCreated(ctx, e)
+	}
+}
+
+func (p Publishers) WindowClosing(ctx context.Context, e WindowClosing) {
+	for _, pub := range p {
+		pub.WindowClosing(ctx, e)
+	}
+}
+
+func (p Publishers) MatchSkipped(ctx context.Context, e MatchSkipped) {
+	for _, pub := range p {
+		pub.MatchSkipped(ctx, e)
+	}
+}
+
+// publishMatchCreated hands e to the publisher, if there is one.
+func (s *Service) publishMatchCreated(ctx context.Context, e MatchCreated) {
+	if s.events != nil {
+		s.events.MatchCreated(ctx, e)
+	}
+}
+
+// AnnounceDueMatches emits MatchCreated for every session whose reveal time
+// has passed and that has not been announced yet. Marking and reading the
+// sessions in one statement means each is announced once, even with several
+// schedulers running.
+func (s *Service) AnnounceDueMatches(ctx context.Context) (int, error) {
+	rows, err := s.db.Query(ctx,
+		`UPDATE chat_sessions SET announced_at = NOW()
+		 WHERE announced_at IS NULL AND reveal_at <= NOW()
+		 RETURNING id, user1_id, user2_id, reveal_at`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var due []MatchCreated
+	for rows.Next() {
+		var e MatchCreated
+		if err := rows.Scan(&e.SessionID, &e.UserIDs[0], &e.UserIDs[1], &e.RevealAt); err != nil {
+			log.Printf("matcher: announce: %v", err)
+			continue
+		}
+		due = append(due, e)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, e := range due {
+		s.publishMatchCreated(ctx, e)
+	}
+	return len(due), nil
+}
+
+// AnnounceClosingWindows emits WindowClosing for every active session ending
+// within closingNotice that has not been warned yet.
+func (s *Service) AnnounceClosingWindows(ctx context.Context) (int, error) {
+	rows, err := s.db.Query(ctx,
+		`UPDATE chat_sessions SET closing_notified_at = NOW()
+		 WHERE status = 'active' AND closing_notified_at IS NULL
+		   AND ends_at > NOW() AND ends_at <= NOW() + $1::interval
+		 RETURNING id, user1_id, user2_id, ends_at`,
+		closingNotice)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var closing []WindowClosing
+	for rows.Next() {
+		var e WindowClosing
+		if err := rows.Scan(&e.SessionID, &e.UserIDs[0], &e.UserIDs[1], &e.EndsAt); err != nil {
+			log.Printf("matcher: closing windows: %v", err)
+			continue
+		}
+		closing = append(closing, e)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if s.events != nil {
+		for _, e := range closing {
+			s.events.WindowClosing(ctx, e)
+		}
+	}
+	return len(closing), nil
+}
@@ -0,0 +1,178 @@
+package matcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"github.com/uniqsocial/backend/internal/scoring"
+)
+
+// minFeedbackSamples is how many rated sessions must compare a trait before
+// feedback adjusts its weight.
+const minFeedbackSamples = 50
+
+// feedbackSampleLimit bounds how many of the most recently rated sessions
+// are learned from.
+const feedbackSampleLimit = 5000
+
+// learnedScorer is a TraitScorer whose weights are re-fitted to post-chat
+// feedback by Service.LearnFromFeedback. Until then it scores with the
+// configured weights.
+type learnedScorer struct {
+	base    map[string]float64
+	current atomic.Pointer[TraitScorer]
+}
+
+func newLearnedScorer(base *TraitScorer) *learnedScorer {
+	s := &learnedScorer{base: base.weights}
+	s.current.Store(base)
+	return s
+}
+
+func (s *learnedScorer) Compatibility(a, b *Traits) float64 {
+	return s.current.Load().Compatibility(a, b)
+}
+
+// feedbackSample is a rated session: both users' traits and the mean
+// scoring.FeedbackValue of the feedback they left.
+type feedbackSample struct {
+	a, b    *Traits
+	outcome float64
+}
+
+// LearnFromFeedback re-fits the trait weights of the default compatibility
+// scorer to recent post-chat feedback, and returns how many rated sessions it
+// learned from. Each trait's configured weight is scaled by 1 + r, where r is
+// the correlation between how similar the pair was on that trait and how well
+// their chat was rated, so traits that predict good chats gain weight and
+// those that predict bad ones fade out. Traits with fewer than
+// minFeedbackSamples comparable sessions keep their configured weight.
+func (s *Service) LearnFromFeedback(ctx context.Context) (int, error) {
+	scorer, ok := s.cfg.Compatibility.(*learnedScorer)
+	if !ok {
+		return 0, nil
+	}
+
+	samples, err := s.feedbackSamples(ctx)
+	if err != nil {
+		return 0, err
+	}
+	scorer.current.Store(NewTraitScorer(learnTraitWeights(scorer.base, samples)))
+	return len(samples), nil
+}
+
+func (s *Service) feedbackSamples(ctx context.Context) ([]feedbackSample, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT cs.user1_id, cs.user2_id, AVG(`+scoring.FeedbackValue+`)
+		 FROM session_feedback f
+		 JOIN chat_sessions cs ON cs.id = f.session_id
+		 GROUP BY cs.id, cs.user1_id, cs.user2_id
+		 ORDER BY MAX(f.updated_at) DESC
+		 LIMIT $1`, feedbackSampleLimit)
+	if err != nil {
+		return nil, fmt.Errorf("query feedback: %w", err)
+	}
+	type rated struct {
+		user1, user2 string
+		outcome      float64
+	}
+	var sessions []rated
+	var ids []string
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var r rated
+		if err := rows.Scan(&r.user1, &r.user2, &r.outcome); err != nil {
+			continue
+		}
+		sessions = append(sessions, r)
+		for _, id := range []string{r.user1, r.user2} {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query feedback: %w", err)
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+
+	rows, err = s.db.Query(ctx,
+		`SELECT u.id, `+traitColumns+`
+		 FROM users u
+		 LEFT JOIN user_profiles up ON up.user_id = u.id
+		 WHERE u.id = ANY($1::uuid[])`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("query traits: %w", err)
+	}
+	defer rows.Close()
+
+	traits := make(map[string]*Traits, len(ids))
+	for rows.Next() {
+		var id string
+		var t Traits
+		if err := rows.Scan(append([]interface{}{&id}, t.scanDest()...)...); err != nil {
+			continue
+		}
+		traits[id] = &t
+	}
+
+	var samples []feedbackSample
+	for _, r := range sessions {
+		a, b := traits[r.user1], traits[r.user2]
+		if a != nil && b != nil {
+			samples = append(samples, feedbackSample{a: a, b: b, outcome: r.outcome})
+		}
+	}
+	return samples, rows.Err()
+}
+
+// learnTraitWeights scales each base weight by 1 + the correlation between
+// trait similarity and outcome across samples.
+func learnTraitWeights(base map[string]float64, samples []feedbackSample) map[string]float64 {
+	weights := make(map[string]float64, len(base))
+	for name, w := range base {
+		var sims, outcomes []float64
+		for _, s := range samples {
+			if sim, ok := traitSimilarity(name, s.a, s.b); ok {
+				sims = append(sims, sim)
+				outcomes = append(outcomes, s.outcome)
+			}
+		}
+		if len(sims) < minFeedbackSamples {
+			weights[name] = w
+			continue
+		}
+		weights[name] = w * (1 + correlation(sims, outcomes))
+	}
+	return weights
+}
+
+// correlation returns the Pearson correlation of x and y, or 0 if either
+// does not vary.
+func correlation(x, y []float64) float64 {
+	n := float64(len(x))
+	var sx, sy float64
+	for i := range x {
+		sx += x[i]
+		sy += y[i]
+	}
+	mx, my := sx/n, sy/n
+
+	var cov, vx, vy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(vx*vy)
+}
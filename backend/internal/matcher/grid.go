@@ -0,0 +1,111 @@
+package matcher
+
+import "math"
+
+// kmPerDegree is the length of one degree of latitude.
+const kmPerDegree = 111.32
+
+// boundingBox returns the latitude/longitude box that contains every point
+// within km of (lat, lng). When the box crosses the antimeridian minLng is
+// greater than maxLng.
+func boundingBox(lat, lng, km float64) (minLat, maxLat, minLng, maxLng float64) {
+	dLat := km / kmPerDegree
+	minLat = math.Max(lat-dLat, -90)
+	maxLat = math.Min(lat+dLat, 90)
+
+	// Near the poles the box spans every longitude
+	cos := math.Cos(math.Max(math.Abs(minLat), math.Abs(maxLat)) * math.Pi / 180)
+	if cos <= 0 || km/(kmPerDegree*cos) >= 180 {
+		return minLat, maxLat, -180, 180
+	}
+	dLng := km / (kmPerDegree * cos)
+	return minLat, maxLat, wrapLongitude(lng - dLng), wrapLongitude(lng + dLng)
+}
+
+func wrapLongitude(lng float64) float64 {
+	if lng < -180 {
+		return lng + 360
+	}
+	if lng > 180 {
+		return lng - 360
+	}
+	return lng
+}
+
+type cell struct {
+	row, col int
+}
+
+// grid buckets users into square cells of a fixed size in degrees so that
+// only users in nearby cells have to be compared.
+type grid struct {
+	users []candidate
+	size  float64
+	cols  int
+	cells map[cell][]int
+}
+
+// newGrid indexes users into cells one radius tall.
+func newGrid(users []candidate, radiusKm float64) *grid {
+	size := radiusKm / kmPerDegree
+	g := &grid{
+		users: users,
+		size:  size,
+		cols:  int(math.Ceil(360 / size)),
+		cells: make(map[cell][]int),
+	}
+	for i, u := range users {
+		c := g.cellOf(u.Latitude, u.Longitude)
+		g.cells[c] = append(g.cells[c], i)
+	}
+	return g
+}
+
+func (g *grid) cellOf(lat, lng float64) cell {
+	return cell{
+		row: int(math.Floor((lat + 90) / g.size)),
+		col: int(math.Floor((lng+180)/g.size)) % g.cols,
+	}
+}
+
+// pairsWithin calls fn once for every pair of users at most radiusKm apart.
+func (g *grid) pairsWithin(radiusKm float64, fn func(i, j int, dist float64)) {
+	for i, u := range g.users {
+		minLat, maxLat, minLng, maxLng := boundingBox(u.Latitude, u.Longitude, radiusKm)
+		lo, hi := g.cellOf(minLat, minLng), g.cellOf(maxLat, maxLng)
+
+		var cols []int
+		switch {
+		case minLng == -180 && maxLng == 180:
+			for c := 0; c < g.cols; c++ {
+				cols = append(cols, c)
+			}
+		case lo.col <= hi.col:
+			for c := lo.col; c <= hi.col; c++ {
+				cols = append(cols, c)
+			}
+		default:
+			// The box wraps around the antimeridian
+			for c := lo.col; c < g.cols; c++ {
+				cols = append(cols, c)
+			}
+			for c := 0; c <= hi.col; c++ {
+				cols = append(cols, c)
+			}
+		}
+
+		for row := lo.row; row <= hi.row; row++ {
+			for _, col := range cols {
+				for _, j := range g.cells[cell{row, col}] {
+					if j <= i {
+						continue
+					}
+					v := g.users[j]
+					if dist := haversine(u.Latitude, u.Longitude, v.Latitude, v.Longitude); dist <= radiusKm {
+						fn(i, j, dist)
+					}
+				}
+			}
+		}
+	}
+}
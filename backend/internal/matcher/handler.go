@@ -19,6 +19,7 @@ type MatchResult struct {
 	PartnerUsername  string    `json:"partner_username"`
 	PartnerPhoto    *string   `json:"partner_photo"`
 	StartedAt       time.Time `json:"started_at"`
+	RevealAt        time.Time `json:"reveal_at"`
 }
 
 func NewHandler(svc *Service) *Handler {
@@ -37,10 +38,7 @@ func (h *Handler) GetToday(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response.JSON(w, http.StatusOK, map[string]interface{}{
-		"matched": true,
-		"match":   match,
-	})
+	response.JSON(w, http.StatusOK, matchResponse(match))
 }
 
 func (h *Handler) Find(w http.ResponseWriter, r *http.Request) {
@@ -52,8 +50,22 @@ func (h *Handler) Find(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response.JSON(w, http.StatusOK, map[string]interface{}{
+	response.JSON(w, http.StatusOK, matchResponse(match))
+}
+
+// matchResponse reports a match, or only when it will be revealed while it
+// is still pending.
+func matchResponse(match *MatchResult) map[string]interface{} {
+	if match.Status == "pending" {
+		return map[string]interface{}{
+			"matched":   false,
+			"pending":   true,
+			"reveal_at": match.RevealAt,
+			"message":   "your match will be revealed soon",
+		}
+	}
+	return map[string]interface{}{
 		"matched": true,
 		"match":   match,
-	})
+	}
 }
@@ -0,0 +1,90 @@
+package matcher
+
+import (
+	"context"
+	"time"
+)
+
+// RematchNever as Config.RematchCooldownDays excludes every previous partner.
+const RematchNever = -1
+
+// historyCutoff returns the earliest session start that still prevents two
+// users from being matched again, or false when rematches are allowed.
+func (c Config) historyCutoff(now time.Time) (time.Time, bool) {
+	switch {
+	case c.RematchCooldownDays == RematchNever:
+		return time.Time{}, true
+	case c.RematchCooldownDays > 0:
+		return now.AddDate(0, 0, -c.RematchCooldownDays), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// notMatchedSince is a SQL condition that holds when user u has had no
+// session with the user in the first placeholder since the second one. It is
+// served by idx_chat_sessions_pair.
+const notMatchedSince = `NOT EXISTS (
+		       SELECT 1 FROM chat_sessions h
+		       WHERE LEAST(h.user1_id, h.user2_id) = LEAST(%[1]s::uuid, u.id)
+		         AND GREATEST(h.user1_id, h.user2_id) = GREATEST(%[1]s::uuid, u.id)
+		         AND h.started_at >= %[2]s
+		   )`
+
+// notSkipped is a SQL condition that holds when neither user u nor the user
+// in the placeholder has skipped a session with the other. Skipped pairs are
+// never matched again, whatever the rematch cooldown.
+const notSkipped = `NOT EXISTS (
+		       SELECT 1 FROM chat_sessions h
+		       WHERE LEAST(h.user1_id, h.user2_id) = LEAST(%[1]s::uuid, u.id)
+		         AND GREATEST(h.user1_id, h.user2_id) = GREATEST(%[1]s::uuid, u.id)
+		         AND h.status = 'skipped'
+		   )`
+
+// pairHistory is the set of user pairs that may not be matched again.
+type pairHistory map[[2]string]bool
+
+func pairKey(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+func (h pairHistory) has(a, b string) bool {
+	return h[pairKey(a, b)]
+}
+
+// loadPairHistory returns the pairs among the given users that have been
+// matched within the rematch cooldown or where one skipped the other. Both
+// ends of a pair are looked up through idx_chat_sessions_pair.
+func (s *Service) loadPairHistory(ctx context.Context, userIDs []string) (pairHistory, error) {
+	history := make(pairHistory)
+
+	// Without a cooldown the cutoff stays NULL and only skips count
+	var cutoff *time.Time
+	if c, ok := s.cfg.historyCutoff(time.Now()); ok {
+		cutoff = &c
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT cs.user1_id, cs.user2_id
+		 FROM chat_sessions cs
+		 WHERE LEAST(cs.user1_id, cs.user2_id) = ANY($1::uuid[])
+		   AND GREATEST(cs.user1_id, cs.user2_id) = ANY($1::uuid[])
+		   AND (cs.started_at >= $2::timestamptz OR cs.status = 'skipped')`,
+		userIDs, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a, b string
+		if err := rows.Scan(&a, &b); err != nil {
+			continue
+		}
+		history[pairKey(a, b)] = true
+	}
+	return history, rows.Err()
+}
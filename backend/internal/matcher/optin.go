@@ -0,0 +1,156 @@
+package matcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/uniqsocial/backend/internal/auth"
+	"github.com/uniqsocial/backend/pkg/response"
+)
+
+// DefaultActiveWindow is used when Config.ActiveWindow is not set.
+const DefaultActiveWindow = 12 * time.Hour
+
+var (
+	errNoLocation = errors.New("user has no location set")
+	errUnverified = errors.New("verify your email to start matching")
+	errNotInPool  = errors.New("user is not in tonight's match pool")
+)
+
+// poolKey returns the Redis sorted set holding the users of a timezone who
+// opted in for their current local day. Members are scored with the Unix time
+// they were last seen.
+func poolKey(timezone string, loc *time.Location) string {
+	return fmt.Sprintf("match:pool:%s:%s", timezone, time.Now().In(loc).Format("2006-01-02"))
+}
+
+// OptIn puts a user into tonight's matching pool and returns when the pool
+// closes, at their local midnight.
+func (s *Service) OptIn(ctx context.Context, userID string) (time.Time, error) {
+	var timezone string
+	var located, verified bool
+	err := s.db.QueryRow(ctx,
+		`SELECT timezone, latitude IS NOT NULL AND longitude IS NOT NULL, email_verified_at IS NOT NULL
+		 FROM users WHERE id = $1 AND deletion_requested_at IS NULL`,
+		userID).Scan(&timezone, &located, &verified)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !located {
+		return time.Time{}, errNoLocation
+	}
+	if !verified {
+		return time.Time{}, errUnverified
+	}
+	return s.joinPool(ctx, userID, timezone)
+}
+
+func (s *Service) joinPool(ctx context.Context, userID, timezone string) (time.Time, error) {
+	loc := loadLocation(timezone)
+	key := poolKey(timezone, loc)
+	_, midnight := dayBounds(loc, time.Now())
+
+	pipe := s.rdb.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(time.Now().Unix()), Member: userID})
+	pipe.ExpireAt(ctx, key, midnight)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("join pool: %w", err)
+	}
+	return midnight, nil
+}
+
+// OptOut takes a user out of tonight's matching pool.
+func (s *Service) OptOut(ctx context.Context, userID string) error {
+	var timezone string
+	if err := s.db.QueryRow(ctx,
+		`SELECT timezone FROM users WHERE id = $1`, userID).Scan(&timezone); err != nil {
+		return err
+	}
+	return s.rdb.ZRem(ctx, poolKey(timezone, loadLocation(timezone)), userID).Err()
+}
+
+// markActive refreshes when an opted-in user was last seen. Users who have
+// not opted in today are left out.
+func (s *Service) markActive(ctx context.Context, userID, timezone string) {
+	s.rdb.ZAddXX(ctx, poolKey(timezone, loadLocation(timezone)),
+		redis.Z{Score: float64(time.Now().Unix()), Member: userID})
+}
+
+// activeCutoff returns the earliest last-seen time a pooled user may have and
+// still be matched.
+func (c Config) activeCutoff(now time.Time) time.Time {
+	return now.Add(-c.ActiveWindow)
+}
+
+// activePool returns the users of a timezone who opted in today and were seen
+// within the active window.
+func (s *Service) activePool(ctx context.Context, timezone string) ([]string, error) {
+	cutoff := s.cfg.activeCutoff(time.Now())
+	return s.rdb.ZRangeByScore(ctx, poolKey(timezone, loadLocation(timezone)), &redis.ZRangeBy{
+		Min: strconv.FormatInt(cutoff.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+}
+
+// inActivePool reports which of users opted in for their own local today and
+// were seen within the active window.
+func (s *Service) inActivePool(ctx context.Context, users []candidate) (map[string]bool, error) {
+	pipe := s.rdb.Pipeline()
+	scores := make([]*redis.FloatCmd, len(users))
+	for i, u := range users {
+		scores[i] = pipe.ZScore(ctx, poolKey(u.Timezone, loadLocation(u.Timezone)), u.UserID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	cutoff := float64(s.cfg.activeCutoff(time.Now()).Unix())
+	active := make(map[string]bool)
+	for i, cmd := range scores {
+		if seen, err := cmd.Result(); err == nil && seen >= cutoff {
+			active[users[i].UserID] = true
+		}
+	}
+	return active, nil
+}
+
+func (h *Handler) OptIn(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+
+	until, err := h.svc.OptIn(r.Context(), userID)
+	switch {
+	case errors.Is(err, errNoLocation), errors.Is(err, errUnverified):
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		response.Error(w, http.StatusNotFound, "user not found")
+		return
+	case err != nil:
+		response.Error(w, http.StatusInternalServerError, "failed to opt in")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"opted_in":   true,
+		"expires_at": until,
+	})
+}
+
+func (h *Handler) OptOut(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+
+	if err := h.svc.OptOut(r.Context(), userID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to opt out")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"opted_in": false,
+	})
+}
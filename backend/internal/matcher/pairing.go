@@ -0,0 +1,213 @@
+package matcher
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Pairing strategies for batch matching, selected with MATCH_STRATEGY.
+const (
+	// StrategyGreedy takes pairs in descending priority order.
+	StrategyGreedy = "greedy"
+	// StrategyMaxWeight maximises the total priority of the pairs made. Cohorts
+	// larger than Config.ExactMaxUsers use an approximation instead.
+	StrategyMaxWeight = "max_weight"
+
+	strategyApprox = "max_weight_approx"
+)
+
+// weightScale converts float priorities into the integer weights the blossom
+// algorithm needs.
+const weightScale = 1e6
+
+// approxPasses bounds the local-search passes of the approximate matcher.
+const approxPasses = 5
+
+// BatchReport summarises one batch matching run so strategies can be compared.
+type BatchReport struct {
+	Timezone    string
+	Strategy    string
+	Users       int
+	Candidates  int
+	Pairs       int
+	Matched     int
+	Unmatched   int
+	AvgPriority float64
+	Duration    time.Duration
+}
+
+func (r BatchReport) String() string {
+	return fmt.Sprintf("%s: strategy=%s users=%d candidates=%d pairs=%d matched=%d unmatched=%d avg_priority=%.3f took=%s",
+		r.Timezone, r.Strategy, r.Users, r.Candidates, r.Pairs, r.Matched, r.Unmatched, r.AvgPriority, r.Duration.Round(time.Millisecond))
+}
+
+// weightedEdge is a possible pairing between users u and v.
+type weightedEdge struct {
+	u, v   int
+	weight int64
+}
+
+// pair chooses which of the n users to pair along the candidate edges and
+// returns the chosen pairs and the strategy that produced them.
+func (c Config) pair(n int, candidates []matchCandidate, index map[string]int) ([]matchCandidate, string) {
+	if c.Strategy != StrategyMaxWeight {
+		return greedyPairs(candidates), StrategyGreedy
+	}
+
+	edges := make([]weightedEdge, len(candidates))
+	for k, p := range candidates {
+		edges[k] = weightedEdge{u: index[p.User1], v: index[p.User2], weight: int64(math.Round(p.Priority * weightScale))}
+	}
+
+	var mate []int
+	strategy := StrategyMaxWeight
+	if c.ExactMaxUsers > 0 && n > c.ExactMaxUsers {
+		mate = approxMatching(n, edges)
+		strategy = strategyApprox
+	} else {
+		mate = maxWeightMatching(n, edges)
+	}
+
+	var pairs []matchCandidate
+	for k, e := range edges {
+		if mate[e.u] == e.v {
+			pairs = append(pairs, candidates[k])
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Priority > pairs[j].Priority
+	})
+	return pairs, strategy
+}
+
+// greedyPairs takes candidate pairs in descending priority order, skipping any
+// that involve an already paired user.
+func greedyPairs(candidates []matchCandidate) []matchCandidate {
+	sorted := make([]matchCandidate, len(candidates))
+	copy(sorted, candidates)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+
+	paired := make(map[string]bool)
+	var pairs []matchCandidate
+	for _, p := range sorted {
+		if paired[p.User1] || paired[p.User2] {
+			continue
+		}
+		paired[p.User1] = true
+		paired[p.User2] = true
+		pairs = append(pairs, p)
+	}
+	return pairs
+}
+
+// approxMatching starts from the greedy matching and improves it with local
+// moves until none applies or approxPasses is reached:
+//
+//   - augment: replace a-b with u-a and b-v when u and v are unpaired, which
+//     pairs two more users;
+//   - steal: replace a-b with a-u for an unpaired u when that weighs more;
+//   - swap: replace a-b and c-d with a-c and b-d when that weighs more.
+//
+// Each pass is linear in the number of edges, so it suits cohorts too large
+// for maxWeightMatching.
+func approxMatching(n int, edges []weightedEdge) []int {
+	type neighbour struct {
+		v      int
+		weight int64
+	}
+	adj := make([][]neighbour, n)
+	for _, e := range edges {
+		adj[e.u] = append(adj[e.u], neighbour{e.v, e.weight})
+		adj[e.v] = append(adj[e.v], neighbour{e.u, e.weight})
+	}
+
+	sorted := make([]weightedEdge, len(edges))
+	copy(sorted, edges)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].weight > sorted[j].weight
+	})
+
+	mate := filled(n, -1)
+	mateWeight := make([]int64, n)
+	link := func(u, v int, w int64) {
+		mate[u], mate[v] = v, u
+		mateWeight[u], mateWeight[v] = w, w
+	}
+	for _, e := range sorted {
+		if mate[e.u] == -1 && mate[e.v] == -1 {
+			link(e.u, e.v, e.weight)
+		}
+	}
+
+	// bestFree returns the heaviest unpaired neighbour of a other than skip.
+	bestFree := func(a, skip int) (int, int64) {
+		best, weight := -1, int64(0)
+		for _, nb := range adj[a] {
+			if nb.v != skip && mate[nb.v] == -1 && (best == -1 || nb.weight > weight) {
+				best, weight = nb.v, nb.weight
+			}
+		}
+		return best, weight
+	}
+
+	// weightTo holds the edge weights from one vertex while it is examined
+	weightTo := make([]int64, n)
+	for i := range weightTo {
+		weightTo[i] = -1
+	}
+
+	for pass := 0; pass < approxPasses; pass++ {
+		improved := false
+		for a := 0; a < n; a++ {
+			b := mate[a]
+			if b == -1 {
+				continue
+			}
+			current := mateWeight[a]
+
+			if u, wu := bestFree(a, -1); u != -1 {
+				if v, wv := bestFree(b, u); v != -1 && wu+wv > current {
+					link(u, a, wu)
+					link(b, v, wv)
+					improved = true
+					continue
+				}
+				if wu > current {
+					mate[b] = -1
+					link(u, a, wu)
+					improved = true
+					continue
+				}
+			}
+
+			for _, nb := range adj[b] {
+				weightTo[nb.v] = nb.weight
+			}
+			for _, nb := range adj[a] {
+				c := nb.v
+				d := mate[c]
+				if c == b || d == -1 || d == a || weightTo[d] < 0 {
+					continue
+				}
+				if nb.weight+weightTo[d] > current+mateWeight[c] {
+					wbd := weightTo[d]
+					link(a, c, nb.weight)
+					link(b, d, wbd)
+					improved = true
+					break
+				}
+			}
+			for _, nb := range adj[b] {
+				weightTo[nb.v] = -1
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	return mate
+}
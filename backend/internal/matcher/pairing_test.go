@@ -0,0 +1,221 @@
+package matcher
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// bruteForceMatching returns the weight of a maximum-weight matching by trying
+// every matching. It is only usable on small graphs.
+func bruteForceMatching(n int, edges []weightedEdge) int64 {
+	weight := make([][]int64, n)
+	for i := range weight {
+		weight[i] = make([]int64, n)
+		for j := range weight[i] {
+			weight[i][j] = -1
+		}
+	}
+	for _, e := range edges {
+		weight[e.u][e.v] = e.weight
+		weight[e.v][e.u] = e.weight
+	}
+
+	used := make([]bool, n)
+	var best func(i int) int64
+	best = func(i int) int64 {
+		for i < n && used[i] {
+			i++
+		}
+		if i == n {
+			return 0
+		}
+		used[i] = true
+		total := best(i + 1) // leave i unpaired
+		for j := i + 1; j < n; j++ {
+			if used[j] || weight[i][j] < 0 {
+				continue
+			}
+			used[j] = true
+			if w := weight[i][j] + best(i+1); w > total {
+				total = w
+			}
+			used[j] = false
+		}
+		used[i] = false
+		return total
+	}
+	return best(0)
+}
+
+// matchingWeight checks that mate is a valid matching along edges and returns
+// its total weight.
+func matchingWeight(t *testing.T, n int, edges []weightedEdge, mate []int) int64 {
+	t.Helper()
+	if len(mate) != n {
+		t.Fatalf("mate has %d entries, want %d", len(mate), n)
+	}
+	for u, v := range mate {
+		if v == -1 {
+			continue
+		}
+		if v < 0 || v >= n || v == u || mate[v] != u {
+			t.Fatalf("mate[%d] = %d but mate[%d] = %d", u, v, v, mate[v])
+		}
+	}
+
+	var total int64
+	paired := make(map[int]bool)
+	for _, e := range edges {
+		if mate[e.u] != e.v {
+			continue
+		}
+		if paired[e.u] || paired[e.v] {
+			t.Fatalf("user %d or %d is paired twice", e.u, e.v)
+		}
+		paired[e.u], paired[e.v] = true, true
+		total += e.weight
+	}
+	for u, v := range mate {
+		if v != -1 && !paired[u] {
+			t.Fatalf("%d is paired with %d without an edge between them", u, v)
+		}
+	}
+	return total
+}
+
+// randomGraph returns a graph on n vertices where each pair is an edge with
+// probability density, with weights in [1, maxWeight].
+func randomGraph(rng *rand.Rand, n int, density float64, maxWeight int64) []weightedEdge {
+	var edges []weightedEdge
+	for u := 0; u < n; u++ {
+		for v := u + 1; v < n; v++ {
+			if rng.Float64() < density {
+				edges = append(edges, weightedEdge{u: u, v: v, weight: 1 + rng.Int63n(maxWeight)})
+			}
+		}
+	}
+	return edges
+}
+
+func TestMaxWeightMatching(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		edges  []weightedEdge
+		weight int64
+	}{
+		{"empty", 0, nil, 0},
+		{"no edges", 3, nil, 0},
+		{"single edge", 2, []weightedEdge{{0, 1, 1}}, 1},
+		{"heavier middle edge", 3, []weightedEdge{{0, 1, 10}, {1, 2, 11}}, 11},
+		{"middle beats both ends", 4, []weightedEdge{{0, 1, 5}, {1, 2, 11}, {2, 3, 5}}, 11},
+		{"ends beat middle", 4, []weightedEdge{{0, 1, 6}, {1, 2, 11}, {2, 3, 6}}, 12},
+		{"blossom", 4, []weightedEdge{{0, 1, 8}, {0, 2, 9}, {1, 2, 10}, {2, 3, 7}}, 15},
+		{"blossom with two stems", 6, []weightedEdge{
+			{0, 1, 8}, {0, 2, 9}, {1, 2, 10}, {2, 3, 7}, {0, 5, 5}, {3, 4, 6},
+		}, 21},
+		{"blossom relabelled", 6, []weightedEdge{
+			{0, 1, 9}, {0, 2, 8}, {1, 2, 10}, {0, 3, 5}, {3, 4, 4}, {0, 5, 3},
+		}, 17},
+		{"nested blossom", 6, []weightedEdge{
+			{0, 1, 9}, {0, 2, 9}, {1, 2, 10}, {1, 3, 8}, {2, 4, 8}, {3, 4, 10}, {4, 5, 6},
+		}, 23},
+		{"relabel blossom and expand", 8, []weightedEdge{
+			{0, 1, 23}, {0, 4, 22}, {0, 5, 15}, {1, 2, 25}, {2, 3, 22}, {3, 4, 25}, {3, 7, 14}, {4, 6, 13},
+		}, 67},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := bruteForceMatching(tt.n, tt.edges)
+			if want != tt.weight {
+				t.Fatalf("brute force found %d, want %d", want, tt.weight)
+			}
+			mate := maxWeightMatching(tt.n, tt.edges)
+			if got := matchingWeight(t, tt.n, tt.edges, mate); got != want {
+				t.Errorf("weight = %d, want %d (mate %v)", got, want, mate)
+			}
+		})
+	}
+}
+
+func TestMaxWeightMatchingRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		n := 1 + rng.Intn(10)
+		density := 0.2 + 0.8*rng.Float64()
+		// Small weight ranges produce many ties, large ones few
+		maxWeight := []int64{3, 20, 1000000}[rng.Intn(3)]
+		edges := randomGraph(rng, n, density, maxWeight)
+
+		want := bruteForceMatching(n, edges)
+		mate := maxWeightMatching(n, edges)
+		if got := matchingWeight(t, n, edges, mate); got != want {
+			t.Fatalf("case %d: weight = %d, want %d\nedges %v\nmate %v", i, got, want, edges, mate)
+		}
+	}
+}
+
+func TestApproxMatching(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		n := 2 + rng.Intn(200)
+		density := 5 / float64(n)
+		if rng.Intn(2) == 0 {
+			density = rng.Float64()
+		}
+		edges := randomGraph(rng, n, density, []int64{3, 1000000}[rng.Intn(2)])
+
+		mate := approxMatching(n, edges)
+		got := matchingWeight(t, n, edges, mate)
+
+		candidates := make([]matchCandidate, len(edges))
+		for k, e := range edges {
+			candidates[k] = matchCandidate{User1: strconv.Itoa(e.u), User2: strconv.Itoa(e.v), Priority: float64(e.weight)}
+		}
+		var greedy int64
+		for _, p := range greedyPairs(candidates) {
+			greedy += int64(p.Priority)
+		}
+		if got < greedy {
+			t.Fatalf("case %d: approx weight %d is below greedy %d", i, got, greedy)
+		}
+
+		if n <= 10 {
+			if best := bruteForceMatching(n, edges); got > best {
+				t.Fatalf("case %d: approx weight %d exceeds the maximum %d", i, got, best)
+			}
+		}
+	}
+}
+
+func TestPairUsesEachUserOnce(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	n := 300
+	index := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		index[strconv.Itoa(i)] = i
+	}
+	var candidates []matchCandidate
+	for _, e := range randomGraph(rng, n, 0.05, 1000) {
+		candidates = append(candidates, matchCandidate{
+			User1: strconv.Itoa(e.u), User2: strconv.Itoa(e.v), Priority: float64(e.weight) / 1000,
+		})
+	}
+
+	for _, cfg := range []Config{
+		{Strategy: StrategyGreedy},
+		{Strategy: StrategyMaxWeight},
+		{Strategy: StrategyMaxWeight, ExactMaxUsers: 100},
+	} {
+		pairs, strategy := cfg.pair(n, candidates, index)
+		seen := make(map[string]bool)
+		for _, p := range pairs {
+			if seen[p.User1] || seen[p.User2] {
+				t.Fatalf("%s: user paired twice in %v", strategy, p)
+			}
+			seen[p.User1], seen[p.User2] = true, true
+		}
+	}
+}
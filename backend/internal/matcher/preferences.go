@@ -0,0 +1,134 @@
+package matcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/uniqsocial/backend/internal/auth"
+	"github.com/uniqsocial/backend/pkg/response"
+)
+
+// Preferences limit who a user can be matched with. Unset fields do not
+// filter. Both paths apply them in both directions: two users are only
+// matched if each meets the other's preferences.
+type Preferences struct {
+	MinAge                   *int     `json:"min_age"`
+	MaxAge                   *int     `json:"max_age"`
+	MaxDistanceKm            *float64 `json:"max_distance_km"`
+	RequireLookingForOverlap bool     `json:"require_looking_for_overlap"`
+}
+
+// preferenceColumns selects a candidate's age and Preferences, with the
+// profile joined as up and preferences as mp.
+const preferenceColumns = `up.age, mp.min_age, mp.max_age, mp.max_distance_km,
+		        COALESCE(mp.require_looking_for_overlap, FALSE)`
+
+func (p *Preferences) scanDest() []interface{} {
+	return []interface{}{&p.MinAge, &p.MaxAge, &p.MaxDistanceKm, &p.RequireLookingForOverlap}
+}
+
+// accepts reports whether other, dist km away, meets c's preferences. Users
+// who have not given their age fail any age limit.
+func (c *candidate) accepts(other *candidate, dist float64) bool {
+	p := c.Prefs
+	if p.MaxDistanceKm != nil && dist > *p.MaxDistanceKm {
+		return false
+	}
+	if p.MinAge != nil || p.MaxAge != nil {
+		if other.Age == nil {
+			return false
+		}
+		if p.MinAge != nil && *other.Age < *p.MinAge {
+			return false
+		}
+		if p.MaxAge != nil && *other.Age > *p.MaxAge {
+			return false
+		}
+	}
+	if p.RequireLookingForOverlap {
+		if shared, ok := jaccard(c.Traits.LookingFor, other.Traits.LookingFor); !ok || shared == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// mutuallyAccept reports whether a and b, dist km apart, meet each other's
+// preferences.
+func mutuallyAccept(a, b *candidate, dist float64) bool {
+	return a.accepts(b, dist) && b.accepts(a, dist)
+}
+
+// GetPreferences returns a user's match preferences, or empty ones if they
+// have not set any.
+func (s *Service) GetPreferences(ctx context.Context, userID string) (*Preferences, error) {
+	var p Preferences
+	err := s.db.QueryRow(ctx,
+		`SELECT min_age, max_age, max_distance_km, require_looking_for_overlap
+		 FROM match_preferences WHERE user_id = $1`, userID).Scan(p.scanDest()...)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SavePreferences replaces a user's match preferences.
+func (s *Service) SavePreferences(ctx context.Context, userID string, p *Preferences) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO match_preferences (user_id, min_age, max_age, max_distance_km, require_looking_for_overlap)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (user_id) DO UPDATE SET
+		    min_age = EXCLUDED.min_age, max_age = EXCLUDED.max_age,
+		    max_distance_km = EXCLUDED.max_distance_km,
+		    require_looking_for_overlap = EXCLUDED.require_looking_for_overlap,
+		    updated_at = NOW()`,
+		userID, p.MinAge, p.MaxAge, p.MaxDistanceKm, p.RequireLookingForOverlap)
+	return err
+}
+
+func (h *Handler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+
+	prefs, err := h.svc.GetPreferences(r.Context(), userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to load preferences")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, prefs)
+}
+
+func (h *Handler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+
+	var req Preferences
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	for _, age := range []*int{req.MinAge, req.MaxAge} {
+		if age != nil && (*age < 18 || *age > 120) {
+			response.Error(w, http.StatusBadRequest, "ages must be between 18 and 120")
+			return
+		}
+	}
+	if req.MinAge != nil && req.MaxAge != nil && *req.MinAge > *req.MaxAge {
+		response.Error(w, http.StatusBadRequest, "min_age must not exceed max_age")
+		return
+	}
+	if req.MaxDistanceKm != nil && *req.MaxDistanceKm <= 0 {
+		response.Error(w, http.StatusBadRequest, "max_distance_km must be positive")
+		return
+	}
+
+	if err := h.svc.SavePreferences(r.Context(), userID, &req); err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to save preferences")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, req)
+}
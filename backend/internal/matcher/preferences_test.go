@@ -0,0 +1,109 @@
+package matcher
+
+import "testing"
+
+func intPtr(v int) *int { return &v }
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestMutuallyAccept(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      candidate
+		dist      float64
+		aAcceptsB bool
+		bAcceptsA bool
+	}{
+		{
+			name:      "no preferences",
+			a:         candidate{},
+			b:         candidate{},
+			dist:      500,
+			aAcceptsB: true, bAcceptsA: true,
+		},
+		{
+			name:      "age limit and no age given",
+			a:         candidate{Age: intPtr(30), Prefs: Preferences{MinAge: intPtr(25)}},
+			b:         candidate{},
+			aAcceptsB: false, bAcceptsA: true,
+		},
+		{
+			name:      "within age range",
+			a:         candidate{Age: intPtr(30), Prefs: Preferences{MinAge: intPtr(25), MaxAge: intPtr(35)}},
+			b:         candidate{Age: intPtr(35)},
+			aAcceptsB: true, bAcceptsA: true,
+		},
+		{
+			name:      "above max age",
+			a:         candidate{Age: intPtr(30), Prefs: Preferences{MaxAge: intPtr(35)}},
+			b:         candidate{Age: intPtr(36)},
+			aAcceptsB: false, bAcceptsA: true,
+		},
+		{
+			name:      "one-sided max distance exceeded",
+			a:         candidate{Prefs: Preferences{MaxDistanceKm: floatPtr(10)}},
+			b:         candidate{},
+			dist:      20,
+			aAcceptsB: false, bAcceptsA: true,
+		},
+		{
+			name:      "one-sided max distance met",
+			a:         candidate{Prefs: Preferences{MaxDistanceKm: floatPtr(10)}},
+			b:         candidate{},
+			dist:      10,
+			aAcceptsB: true, bAcceptsA: true,
+		},
+		{
+			name:      "overlap required and both lists empty",
+			a:         candidate{Prefs: Preferences{RequireLookingForOverlap: true}},
+			b:         candidate{},
+			aAcceptsB: false, bAcceptsA: true,
+		},
+		{
+			name: "overlap required and shared",
+			a: candidate{
+				Traits: Traits{LookingFor: []string{"Friends", "dating"}},
+				Prefs:  Preferences{RequireLookingForOverlap: true},
+			},
+			b:         candidate{Traits: Traits{LookingFor: []string{"friends"}}},
+			aAcceptsB: true, bAcceptsA: true,
+		},
+		{
+			name: "overlap required and nothing shared",
+			a: candidate{
+				Traits: Traits{LookingFor: []string{"dating"}},
+				Prefs:  Preferences{RequireLookingForOverlap: true},
+			},
+			b:         candidate{Traits: Traits{LookingFor: []string{"friends"}}},
+			aAcceptsB: false, bAcceptsA: true,
+		},
+		{
+			name: "asymmetric preferences",
+			a:    candidate{Age: intPtr(22), Prefs: Preferences{MaxAge: intPtr(40)}},
+			b: candidate{
+				Age:   intPtr(38),
+				Prefs: Preferences{MinAge: intPtr(30), MaxDistanceKm: floatPtr(50)},
+			},
+			dist:      10,
+			aAcceptsB: true, bAcceptsA: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.accepts(&tt.b, tt.dist); got != tt.aAcceptsB {
+				t.Errorf("a accepts b = %v, want %v", got, tt.aAcceptsB)
+			}
+			if got := tt.b.accepts(&tt.a, tt.dist); got != tt.bAcceptsA {
+				t.Errorf("b accepts a = %v, want %v", got, tt.bAcceptsA)
+			}
+			want := tt.aAcceptsB && tt.bAcceptsA
+			if got := mutuallyAccept(&tt.a, &tt.b, tt.dist); got != want {
+				t.Errorf("mutuallyAccept(a, b) = %v, want %v", got, want)
+			}
+			if got := mutuallyAccept(&tt.b, &tt.a, tt.dist); got != want {
+				t.Errorf("mutuallyAccept(b, a) = %v, want %v", got, want)
+			}
+		})
+	}
+}
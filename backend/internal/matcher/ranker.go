@@ -0,0 +1,103 @@
+package matcher
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// Features describe a candidate pair to a Ranker. Apart from the raw
+// distance, every signal is in 0–1, higher meaning a better match.
+type Features struct {
+	DistanceKm    float64 // kilometres between the two users
+	Proximity     float64 // 1 at 0 km, 0 at the search radius
+	Engagement    float64 // similarity of the two engagement scores
+	Compatibility float64 // CompatibilityScorer result
+	Reception     float64 // how well both users' past chats were received
+}
+
+// Ranker turns the features of a candidate pair into its priority. Both
+// on-demand and batch matching prefer higher priorities.
+type Ranker interface {
+	Rank(f Features) float64
+}
+
+// PriorityWeights weigh the 0–1 signals that make up a pair's priority.
+type PriorityWeights struct {
+	Proximity     float64
+	Engagement    float64
+	Compatibility float64
+	Reception     float64
+	Jitter        float64
+}
+
+// DefaultPriorityWeights favour nearby users with similar engagement, with
+// some room for compatibility, partner feedback and randomness.
+var DefaultPriorityWeights = PriorityWeights{
+	Proximity:     0.3,
+	Engagement:    0.2,
+	Compatibility: 0.2,
+	Reception:     0.1,
+	Jitter:        0.2,
+}
+
+// WeightedRanker is the default Ranker: a weighted sum of the features plus
+// a random jitter so the same users do not always win.
+type WeightedRanker struct {
+	Weights PriorityWeights
+}
+
+func (r WeightedRanker) Rank(f Features) float64 {
+	w := r.Weights
+	return f.Proximity*w.Proximity +
+		f.Engagement*w.Engagement +
+		f.Compatibility*w.Compatibility +
+		f.Reception*w.Reception +
+		rand.Float64()*w.Jitter
+}
+
+// RankerFactory builds a Ranker from the configured weights.
+type RankerFactory func(weights PriorityWeights) Ranker
+
+// DefaultRanker is the name of the ranker used when none is configured.
+const DefaultRanker = "weighted"
+
+var (
+	rankersMu sync.RWMutex
+	rankers   = map[string]RankerFactory{
+		DefaultRanker: func(weights PriorityWeights) Ranker {
+			return WeightedRanker{Weights: weights}
+		},
+	}
+)
+
+// RegisterRanker makes a ranking strategy available to NewRanker (and so to
+// MATCH_RANKER) under name, replacing any previous one.
+func RegisterRanker(name string, factory RankerFactory) {
+	rankersMu.Lock()
+	defer rankersMu.Unlock()
+	rankers[name] = factory
+}
+
+// NewRanker builds the registered ranker called name.
+func NewRanker(name string, weights PriorityWeights) (Ranker, error) {
+	rankersMu.RLock()
+	factory, ok := rankers[name]
+	rankersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown ranker %q (have %v)", name, rankerNames())
+	}
+	return factory(weights), nil
+}
+
+func rankerNames() []string {
+	rankersMu.RLock()
+	defer rankersMu.RUnlock()
+	names := make([]string, 0, len(rankers))
+	for name := range rankers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -9,10 +9,22 @@ import (
 	"github.com/uniqsocial/backend/internal/scoring"
 )
 
+// matchingHour is the local hour at which each timezone's daily batch runs.
+const matchingHour = 20
+
+// feedbackLearnInterval is how often compatibility weights are re-fitted to
+// post-chat feedback.
+const feedbackLearnInterval = 6 * time.Hour
+
 type Scheduler struct {
 	matcherSvc *Service
 	db         *pgxpool.Pool
 	scoringSvc *scoring.Service
+
+	// lastBatch records the local date each timezone last ran batch matching
+	lastBatch map[string]string
+	// lastLearned is when trait weights were last re-fitted to feedback
+	lastLearned time.Time
 }
 
 func NewScheduler(matcherSvc *Service, db *pgxpool.Pool, scoringSvc *scoring.Service) *Scheduler {
@@ -20,6 +32,7 @@ func NewScheduler(matcherSvc *Service, db *pgxpool.Pool, scoringSvc *scoring.Ser
 		matcherSvc: matcherSvc,
 		db:         db,
 		scoringSvc: scoringSvc,
+		lastBatch:  make(map[string]string),
 	}
 }
 
@@ -35,30 +48,81 @@ func (s *Scheduler) Start(ctx context.Context) {
 			log.Println("scheduler: stopped")
 			return
 		case t := <-ticker.C:
-			hour := t.Hour()
-			minute := t.Minute()
-
-			// Run matching at 8 PM (20:00)
-			if hour == 20 && minute == 0 {
-				log.Println("scheduler: running batch matching")
-				s.matcherSvc.RunBatchMatching(ctx)
+			if t.Sub(s.lastLearned) >= feedbackLearnInterval {
+				s.learnFromFeedback(ctx)
+				s.lastLearned = t
 			}
 
-			// Run midnight cleanup at 00:00
-			if hour == 0 && minute == 0 {
-				log.Println("scheduler: running midnight cleanup")
-				s.midnightCleanup(ctx)
-			}
+			s.runDueBatches(ctx, t)
+			s.announceDueMatches(ctx)
+			s.announceClosingWindows(ctx)
+
+			// End sessions whose local day is over
+			s.midnightCleanup(ctx)
+		}
+	}
+}
+
+// runDueBatches runs batch matching for every timezone that has reached
+// matchingHour and has not been matched yet on its current local date.
+func (s *Scheduler) runDueBatches(ctx context.Context, t time.Time) {
+	zones, err := s.matcherSvc.Timezones(ctx)
+	if err != nil {
+		log.Printf("scheduler: list timezones: %v", err)
+		return
+	}
+
+	for _, tz := range zones {
+		local := t.In(loadLocation(tz))
+		date := local.Format("2006-01-02")
+		if local.Hour() < matchingHour || s.lastBatch[tz] == date {
+			continue
 		}
+
+		log.Printf("scheduler: running batch matching for %s", tz)
+		report := s.matcherSvc.RunBatchMatching(ctx, tz)
+		log.Printf("scheduler: batch matching %s", report)
+		s.lastBatch[tz] = date
+	}
+}
+
+// announceDueMatches tells users about batch matches whose reveal time has
+// come.
+func (s *Scheduler) announceDueMatches(ctx context.Context) {
+	n, err := s.matcherSvc.AnnounceDueMatches(ctx)
+	if err != nil {
+		log.Printf("scheduler: announce matches: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("scheduler: revealed %d matches", n)
+	}
+}
+
+// announceClosingWindows warns users whose session is about to end.
+func (s *Scheduler) announceClosingWindows(ctx context.Context) {
+	if _, err := s.matcherSvc.AnnounceClosingWindows(ctx); err != nil {
+		log.Printf("scheduler: announce closing windows: %v", err)
+	}
+}
+
+func (s *Scheduler) learnFromFeedback(ctx context.Context) {
+	n, err := s.matcherSvc.LearnFromFeedback(ctx)
+	if err != nil {
+		log.Printf("scheduler: learn from feedback: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("scheduler: re-fitted compatibility weights to %d rated sessions", n)
 	}
 }
 
 func (s *Scheduler) midnightCleanup(ctx context.Context) {
-	// End all active chat sessions
+	// End active chat sessions that have reached their local midnight
 	rows, err := s.db.Query(ctx,
 		`UPDATE chat_sessions
 		 SET status = 'ended_by_system', ended_at = NOW()
-		 WHERE status = 'active'
+		 WHERE status = 'active' AND ends_at <= NOW()
 		 RETURNING id, user1_id, user2_id`)
 	if err != nil {
 		log.Printf("scheduler: midnight cleanup query: %v", err)
@@ -79,5 +143,38 @@ func (s *Scheduler) midnightCleanup(ctx context.Context) {
 		count++
 	}
 
-	log.Printf("scheduler: ended %d active sessions", count)
+	if count > 0 {
+		log.Printf("scheduler: ended %d active sessions", count)
+	}
+
+	s.scoreConnections(ctx)
+}
+
+// scoreConnections scores the night of each connection whose window has
+// closed, once, as midnightCleanup does for the sessions it ends.
+func (s *Scheduler) scoreConnections(ctx context.Context) {
+	rows, err := s.db.Query(ctx,
+		`UPDATE chat_sessions SET scored_at = NOW()
+		 WHERE status = 'connected' AND ends_at <= NOW() AND scored_at IS NULL
+		 RETURNING id, user1_id, user2_id`)
+	if err != nil {
+		log.Printf("scheduler: score connections: %v", err)
+		return
+	}
+
+	type session struct{ id, user1, user2 string }
+	var due []session
+	for rows.Next() {
+		var cs session
+		if err := rows.Scan(&cs.id, &cs.user1, &cs.user2); err != nil {
+			continue
+		}
+		due = append(due, cs)
+	}
+	rows.Close()
+
+	for _, cs := range due {
+		s.scoringSvc.ComputeSessionScore(ctx, cs.user1, cs.id)
+		s.scoringSvc.ComputeSessionScore(ctx, cs.user2, cs.id)
+	}
 }
@@ -2,20 +2,25 @@ package matcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math"
-	"math/rand"
 	"sort"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
+
+	"github.com/uniqsocial/backend/internal/scoring"
 )
 
 type Service struct {
-	db  *pgxpool.Pool
-	rdb *redis.Client
+	db         *pgxpool.Pool
+	rdb        *redis.Client
+	scoringSvc *scoring.Service
+	cfg        Config
+	events     EventPublisher
 }
 
 type candidate struct {
@@ -23,229 +28,539 @@ type candidate struct {
 	Latitude  float64
 	Longitude float64
 	Score     float64
+	Reception float64
+	Timezone  string
+	Traits    Traits
+	Age       *int
+	Prefs     Preferences
 }
 
 type matchCandidate struct {
 	User1    string
 	User2    string
 	Priority float64
+	RadiusKm float64
+}
+
+// candidateColumns selects a candidate for the user aliased u, using the
+// aliases from candidateJoins. Scan them with candidate.scanDest.
+const candidateColumns = `u.id, u.latitude, u.longitude, COALESCE(es.score, 50), COALESCE(fs.reception, 0.5), u.timezone,
+		        ` + traitColumns + `,
+		        ` + preferenceColumns
+
+const candidateJoins = `LEFT JOIN engagement_scores es ON es.user_id = u.id
+		 LEFT JOIN feedback_scores fs ON fs.user_id = u.id
+		 LEFT JOIN user_profiles up ON up.user_id = u.id
+		 LEFT JOIN match_preferences mp ON mp.user_id = u.id`
+
+// scanDest returns the destinations for candidateColumns.
+func (c *candidate) scanDest() []interface{} {
+	dest := []interface{}{&c.UserID, &c.Latitude, &c.Longitude, &c.Score, &c.Reception, &c.Timezone}
+	dest = append(dest, c.Traits.scanDest()...)
+	dest = append(dest, &c.Age)
+	return append(dest, c.Prefs.scanDest()...)
+}
+
+// noSessionToday is a SQL condition that holds when the user aliased u has not
+// been matched during their own local day.
+const noSessionToday = `NOT EXISTS (
+		       SELECT 1 FROM daily_matches dm
+		       WHERE dm.user_id = u.id
+		         AND dm.match_date = (NOW() AT TIME ZONE u.timezone)::date
+		   )`
+
+func NewService(db *pgxpool.Pool, rdb *redis.Client, scoringSvc *scoring.Service, cfg Config, events EventPublisher) *Service {
+	cfg = cfg.withDefaults()
+	if scorer, ok := cfg.Compatibility.(*TraitScorer); ok {
+		cfg.Compatibility = newLearnedScorer(scorer)
+	}
+	return &Service{db: db, rdb: rdb, scoringSvc: scoringSvc, cfg: cfg, events: events}
+}
+
+// loadLocation returns the named timezone, falling back to UTC.
+func loadLocation(tz string) *time.Location {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// dayBounds returns the start of the current day in loc and the midnight that
+// ends it.
+func dayBounds(loc *time.Location, now time.Time) (time.Time, time.Time) {
+	local := now.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// matchKey returns the Redis key used to track a user's match for a date.
+func matchKey(userID string, date time.Time) string {
+	return fmt.Sprintf("match:%s:%s", userID, date.Format("2006-01-02"))
 }
 
-func NewService(db *pgxpool.Pool, rdb *redis.Client) *Service {
-	return &Service{db: db, rdb: rdb}
+// matchKeyForToday returns the Redis key used to track a user's match for
+// their current local day.
+func matchKeyForToday(userID string, loc *time.Location) string {
+	return matchKey(userID, time.Now().In(loc))
 }
 
-// matchKeyForToday returns the Redis key used to track today's matches.
-func matchKeyForToday(userID string) string {
-	return fmt.Sprintf("match:%s:%s", userID, time.Now().Format("2006-01-02"))
+// HasMatchToday checks if a user already has a match for their local today.
+func (s *Service) HasMatchToday(ctx context.Context, userID string, loc *time.Location) (bool, error) {
+	return s.rdb.Exists(ctx, matchKeyForToday(userID, loc)).Val() > 0, nil
 }
 
-// HasMatchToday checks if a user already has a match for today.
-func (s *Service) HasMatchToday(ctx context.Context, userID string) (bool, error) {
-	return s.rdb.Exists(ctx, matchKeyForToday(userID)).Val() > 0, nil
+// Timezones returns the distinct timezones of users who can be matched, one
+// per batch-matching cohort.
+func (s *Service) Timezones(ctx context.Context) ([]string, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT DISTINCT timezone FROM users
+		 WHERE latitude IS NOT NULL AND longitude IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var zones []string
+	for rows.Next() {
+		var tz string
+		if err := rows.Scan(&tz); err != nil {
+			continue
+		}
+		zones = append(zones, tz)
+	}
+	return zones, rows.Err()
 }
 
-// GetTodayMatch returns the active chat session for a user today, if any.
+// GetTodayMatch returns the chat session for a user's local today, if any,
+// leaving out skipped sessions. Before the session's reveal time only its
+// status, "pending", and RevealAt are returned.
 func (s *Service) GetTodayMatch(ctx context.Context, userID string) (*MatchResult, error) {
-	today := time.Now().Truncate(24 * time.Hour)
-	tomorrow := today.Add(24 * time.Hour)
+	var tz string
+	if err := s.db.QueryRow(ctx,
+		`SELECT timezone FROM users WHERE id = $1`, userID).Scan(&tz); err != nil {
+		return nil, err
+	}
+	today, tomorrow := dayBounds(loadLocation(tz), time.Now())
+	s.markActive(ctx, userID, tz)
 
 	var result MatchResult
 	err := s.db.QueryRow(ctx,
 		`SELECT cs.id, cs.status,
 		        CASE WHEN cs.user1_id = $1 THEN cs.user2_id ELSE cs.user1_id END as partner_id,
 		        u.username as partner_username, u.photo_url as partner_photo,
-		        cs.started_at
+		        cs.started_at, cs.reveal_at
 		 FROM chat_sessions cs
 		 JOIN users u ON u.id = CASE WHEN cs.user1_id = $1 THEN cs.user2_id ELSE cs.user1_id END
 		 WHERE (cs.user1_id = $1 OR cs.user2_id = $1)
 		   AND cs.started_at >= $2 AND cs.started_at < $3
+		   AND cs.status != 'skipped'
 		 ORDER BY cs.started_at DESC LIMIT 1`,
 		userID, today, tomorrow,
 	).Scan(&result.SessionID, &result.Status, &result.PartnerID,
-		&result.PartnerUsername, &result.PartnerPhoto, &result.StartedAt)
+		&result.PartnerUsername, &result.PartnerPhoto, &result.StartedAt, &result.RevealAt)
 
 	if err != nil {
 		return nil, err
 	}
+	if result.RevealAt.After(time.Now()) {
+		return &MatchResult{Status: "pending", RevealAt: result.RevealAt}, nil
+	}
 	return &result, nil
 }
 
-// FindMatch attempts to find a match for the given user.
+// FindMatch attempts to find a match for the given user, opting them in for
+// tonight.
 func (s *Service) FindMatch(ctx context.Context, userID string) (*MatchResult, error) {
-	has, _ := s.HasMatchToday(ctx, userID)
-	if has {
-		return s.GetTodayMatch(ctx, userID)
-	}
+	return s.findMatch(ctx, userID, true)
+}
 
-	var lat, lng, userScore float64
+// findMatch attempts to find a match for the given user. With join set the
+// user is opted in for tonight first; otherwise they must already be in the
+// active pool and errNotInPool is returned if they are not.
+func (s *Service) findMatch(ctx context.Context, userID string, join bool) (*MatchResult, error) {
+	var me candidate
+	var verified bool
 	err := s.db.QueryRow(ctx,
-		`SELECT u.latitude, u.longitude, COALESCE(es.score, 50)
+		`SELECT u.email_verified_at IS NOT NULL, `+candidateColumns+`
 		 FROM users u
-		 LEFT JOIN engagement_scores es ON es.user_id = u.id
+		 `+candidateJoins+`
 		 WHERE u.id = $1 AND u.latitude IS NOT NULL`,
-		userID).Scan(&lat, &lng, &userScore)
+		userID).Scan(append([]interface{}{&verified}, me.scanDest()...)...)
 	if err != nil {
-		return nil, fmt.Errorf("user has no location set")
+		return nil, errNoLocation
+	}
+
+	if !verified {
+		return nil, errUnverified
+	}
+
+	loc := loadLocation(me.Timezone)
+	has, _ := s.HasMatchToday(ctx, userID, loc)
+	if has {
+		return s.GetTodayMatch(ctx, userID)
+	}
+
+	if join {
+		// Asking for a match opts the user in for tonight, so the batch still
+		// considers them if nobody is available now
+		if _, err := s.joinPool(ctx, userID, me.Timezone); err != nil {
+			return nil, err
+		}
+	} else {
+		active, err := s.inActivePool(ctx, []candidate{me})
+		if err != nil {
+			return nil, fmt.Errorf("check match pool: %w", err)
+		}
+		if !active[userID] {
+			return nil, errNotInPool
+		}
+	}
+
+	// Find candidates within the widest radius this user allows who don't
+	// have a match today. The bounding box lets the location index narrow the
+	// scan before the exact distance check below.
+	steps := s.cfg.radiusSteps(&me.Prefs)
+	maxRadius := steps[len(steps)-1]
+	minLat, maxLat, minLng, maxLng := boundingBox(me.Latitude, me.Longitude, maxRadius)
+	lngCond := "u.longitude BETWEEN $4 AND $5"
+	if minLng > maxLng {
+		lngCond = "(u.longitude >= $4 OR u.longitude <= $5)"
+	}
+	args := []interface{}{userID, minLat, maxLat, minLng, maxLng}
+
+	// Skip previous partners still within the rematch cooldown, and anyone
+	// either user skipped
+	historyCond := "AND " + fmt.Sprintf(notSkipped, "$1")
+	if cutoff, ok := s.cfg.historyCutoff(time.Now()); ok {
+		historyCond += " AND " + fmt.Sprintf(notMatchedSince, "$1", "$6")
+		args = append(args, cutoff)
 	}
 
-	// Find candidates within ~50km who don't have a match today
 	rows, err := s.db.Query(ctx,
-		`SELECT u.id, u.latitude, u.longitude, COALESCE(es.score, 50)
+		`SELECT `+candidateColumns+`
 		 FROM users u
-		 LEFT JOIN engagement_scores es ON es.user_id = u.id
+		 `+candidateJoins+`
 		 WHERE u.id != $1
-		   AND u.latitude IS NOT NULL
-		   AND u.longitude IS NOT NULL
-		   AND NOT EXISTS (
-		       SELECT 1 FROM chat_sessions cs
-		       WHERE (cs.user1_id = u.id OR cs.user2_id = u.id)
-		         AND cs.started_at >= $2::date AND cs.started_at < ($2::date + INTERVAL '1 day')
-		   )`,
-		userID, time.Now().Format("2006-01-02"))
+		   AND u.latitude BETWEEN $2 AND $3
+		   AND `+lngCond+`
+		   AND u.email_verified_at IS NOT NULL
+		   AND u.deletion_requested_at IS NULL
+		   AND `+noSessionToday+`
+		   `+historyCond,
+		args...)
 	if err != nil {
 		return nil, fmt.Errorf("query candidates: %w", err)
 	}
 	defer rows.Close()
 
-	var candidates []candidate
+	var inRange []candidate
 	for rows.Next() {
 		var c candidate
-		if err := rows.Scan(&c.UserID, &c.Latitude, &c.Longitude, &c.Score); err != nil {
+		if err := rows.Scan(c.scanDest()...); err != nil {
 			continue
 		}
-		dist := haversine(lat, lng, c.Latitude, c.Longitude)
-		if dist <= 50.0 {
-			candidates = append(candidates, c)
-		}
+		inRange = append(inRange, c)
 	}
 
-	if len(candidates) == 0 {
-		return nil, fmt.Errorf("no matches available nearby")
+	// Only users who opted in for tonight and are still active can be matched
+	active, err := s.inActivePool(ctx, inRange)
+	if err != nil {
+		return nil, fmt.Errorf("check match pool: %w", err)
 	}
 
-	// Score candidates: proximity (40%) + engagement similarity (40%) + random (20%)
-	type scored struct {
+	type nearby struct {
 		candidate
-		priority float64
+		dist float64
+	}
+	var found []nearby
+	for _, c := range inRange {
+		if !active[c.UserID] {
+			continue
+		}
+		dist := haversine(me.Latitude, me.Longitude, c.Latitude, c.Longitude)
+		if dist <= maxRadius && mutuallyAccept(&me, &c, dist) {
+			found = append(found, nearby{candidate: c, dist: dist})
+		}
 	}
-	scoredCandidates := make([]scored, len(candidates))
-	for i, c := range candidates {
-		dist := haversine(lat, lng, c.Latitude, c.Longitude)
-		proxScore := 1.0 - (dist / 50.0) // 1.0 at 0km, 0.0 at 50km
-		engSimilarity := 1.0 - math.Abs(userScore-c.Score)/100.0
-		jitter := rand.Float64()
 
-		priority := proxScore*0.4 + engSimilarity*0.4 + jitter*0.2
-		scoredCandidates[i] = scored{candidate: c, priority: priority}
+	// Widen the radius step by step, trying the candidates in range in
+	// priority order with proximity scored against the radius that found
+	// them. Anyone matched elsewhere since the query is skipped.
+	now := time.Now()
+	_, endsAt := dayBounds(loc, now)
+	tried := make(map[string]bool)
+	for _, radius := range steps {
+		type ranked struct {
+			*nearby
+			priority float64
+		}
+		var options []ranked
+		for i := range found {
+			if found[i].dist > radius || tried[found[i].UserID] {
+				continue
+			}
+			options = append(options, ranked{&found[i], s.cfg.priority(&me, &found[i].candidate, found[i].dist, radius)})
+		}
+		sort.Slice(options, func(i, j int) bool {
+			return options[i].priority > options[j].priority
+		})
+
+		for _, o := range options {
+			tried[o.UserID] = true
+			// The session lasts until the end of the requesting user's local day
+			_, err := s.createSession(ctx, userID, loc, o.UserID, loadLocation(o.Timezone), endsAt, now, radius)
+			var taken *alreadyMatchedError
+			switch {
+			case err == nil:
+				return s.GetTodayMatch(ctx, userID)
+			case errors.As(err, &taken) && taken.userID == userID:
+				return s.GetTodayMatch(ctx, userID)
+			case errors.As(err, &taken):
+				continue
+			default:
+				return nil, err
+			}
+		}
 	}
 
-	sort.Slice(scoredCandidates, func(i, j int) bool {
-		return scoredCandidates[i].priority > scoredCandidates[j].priority
-	})
+	return nil, fmt.Errorf("no matches available nearby")
+}
+
+// alreadyMatchedError reports that a user was matched for their local today
+// by someone else before a session could be created.
+type alreadyMatchedError struct {
+	userID string
+}
+
+func (e *alreadyMatchedError) Error() string {
+	return fmt.Sprintf("user %s is already matched today", e.userID)
+}
+
+// matchDate returns the current date in loc.
+func matchDate(loc *time.Location) time.Time {
+	y, m, d := time.Now().In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// createSession opens a chat session between two users found within
+// radiusKm that is revealed at revealAt and that the scheduler ends at
+// endsAt, and marks both as matched for their local today. Claiming both
+// users' days in daily_matches happens in the same transaction, so if either
+// was matched concurrently nothing is created and an *alreadyMatchedError
+// names them. Sessions revealed straight away are announced here, and later
+// ones by AnnounceDueMatches.
+func (s *Service) createSession(ctx context.Context, user1 string, loc1 *time.Location, user2 string, loc2 *time.Location, endsAt, revealAt time.Time, radiusKm float64) (string, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("create session: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
-	best := scoredCandidates[0]
+	var announcedAt *time.Time
+	if now := time.Now(); !revealAt.After(now) {
+		announcedAt = &now
+	}
 
-	// Create chat session
 	var sessionID string
-	err = s.db.QueryRow(ctx,
-		`INSERT INTO chat_sessions (user1_id, user2_id) VALUES ($1, $2) RETURNING id`,
-		userID, best.UserID).Scan(&sessionID)
+	err = tx.QueryRow(ctx,
+		`INSERT INTO chat_sessions (user1_id, user2_id, ends_at, radius_km, reveal_at, announced_at)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		user1, user2, endsAt, radiusKm, revealAt, announcedAt).Scan(&sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("create session: %w", err)
+		return "", fmt.Errorf("create session: %w", err)
+	}
+
+	// Claim the days in a fixed order so that two transactions over the same
+	// users wait on each other instead of deadlocking
+	claims := []struct {
+		id  string
+		loc *time.Location
+	}{{user1, loc1}, {user2, loc2}}
+	if claims[1].id < claims[0].id {
+		claims[0], claims[1] = claims[1], claims[0]
+	}
+	for _, u := range claims {
+		tag, err := tx.Exec(ctx,
+			`INSERT INTO daily_matches (user_id, match_date, session_id) VALUES ($1, $2, $3)
+			 ON CONFLICT (user_id, match_date) DO NOTHING`,
+			u.id, matchDate(u.loc), sessionID)
+		if err != nil {
+			return "", fmt.Errorf("claim match day: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return "", &alreadyMatchedError{userID: u.id}
+		}
 	}
 
-	// Mark both users as matched today in Redis (expires at end of day)
-	midnight := time.Now().Truncate(24*time.Hour).Add(24 * time.Hour)
-	ttl := time.Until(midnight)
-	s.rdb.Set(ctx, matchKeyForToday(userID), sessionID, ttl)
-	s.rdb.Set(ctx, matchKeyForToday(best.UserID), sessionID, ttl)
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("create session: %w", err)
+	}
+
+	// Mark both users as matched today in Redis (expires at their local midnight)
+	for _, u := range claims {
+		_, midnight := dayBounds(u.loc, time.Now())
+		s.rdb.Set(ctx, matchKeyForToday(u.id, u.loc), sessionID, time.Until(midnight))
+	}
 
-	return s.GetTodayMatch(ctx, userID)
+	if announcedAt != nil {
+		s.publishMatchCreated(ctx, MatchCreated{SessionID: sessionID, UserIDs: [2]string{user1, user2}, RevealAt: revealAt})
+	}
+
+	return sessionID, nil
 }
 
-// RunBatchMatching runs the matching algorithm for all unmatched users.
-func (s *Service) RunBatchMatching(ctx context.Context) {
+// RunBatchMatching runs the matching algorithm for all unmatched users in one
+// timezone cohort who opted in for tonight and are still active. Their
+// sessions are all revealed together, Config.RevealDelay after the run
+// starts, and end at the cohort's local midnight.
+func (s *Service) RunBatchMatching(ctx context.Context, timezone string) BatchReport {
+	start := time.Now()
+	report := BatchReport{Timezone: timezone, Strategy: s.cfg.Strategy}
+	loc := loadLocation(timezone)
+	_, endsAt := dayBounds(loc, start)
+	revealAt := start.Add(s.cfg.RevealDelay)
+
+	pool, err := s.activePool(ctx, timezone)
+	if err != nil {
+		log.Printf("batch matching: match pool: %v", err)
+		return report
+	}
+	if len(pool) < 2 {
+		report.Users = len(pool)
+		report.Unmatched = len(pool)
+		report.Duration = time.Since(start)
+		return report
+	}
+
 	rows, err := s.db.Query(ctx,
-		`SELECT u.id, u.latitude, u.longitude, COALESCE(es.score, 50)
+		`SELECT `+candidateColumns+`
 		 FROM users u
-		 LEFT JOIN engagement_scores es ON es.user_id = u.id
+		 `+candidateJoins+`
 		 WHERE u.latitude IS NOT NULL AND u.longitude IS NOT NULL
-		   AND NOT EXISTS (
-		       SELECT 1 FROM chat_sessions cs
-		       WHERE (cs.user1_id = u.id OR cs.user2_id = u.id)
-		         AND cs.started_at >= $1::date AND cs.started_at < ($1::date + INTERVAL '1 day')
-		   )`,
-		time.Now().Format("2006-01-02"))
+		   AND u.timezone = $1
+		   AND u.id = ANY($2::uuid[])
+		   AND u.email_verified_at IS NOT NULL
+		   AND u.deletion_requested_at IS NULL
+		   AND `+noSessionToday,
+		timezone, pool)
 	if err != nil {
 		log.Printf("batch matching: query: %v", err)
-		return
+		return report
 	}
 	defer rows.Close()
 
 	var users []candidate
 	for rows.Next() {
 		var c candidate
-		if err := rows.Scan(&c.UserID, &c.Latitude, &c.Longitude, &c.Score); err != nil {
+		if err := rows.Scan(c.scanDest()...); err != nil {
 			continue
 		}
 		users = append(users, c)
 	}
 
+	report.Users = len(users)
 	if len(users) < 2 {
-		log.Println("batch matching: not enough users")
-		return
+		report.Unmatched = len(users)
+		report.Duration = time.Since(start)
+		return report
 	}
 
-	// Build all valid pairs and score them
-	var pairs []matchCandidate
-	for i := 0; i < len(users); i++ {
-		for j := i + 1; j < len(users); j++ {
-			dist := haversine(users[i].Latitude, users[i].Longitude, users[j].Latitude, users[j].Longitude)
-			if dist > 50.0 {
-				continue
-			}
-			proxScore := 1.0 - (dist / 50.0)
-			engSimilarity := 1.0 - math.Abs(users[i].Score-users[j].Score)/100.0
-			jitter := rand.Float64()
-			priority := proxScore*0.4 + engSimilarity*0.4 + jitter*0.2
-
-			pairs = append(pairs, matchCandidate{
-				User1:    users[i].UserID,
-				User2:    users[j].UserID,
-				Priority: priority,
-			})
-		}
+	ids := make([]string, len(users))
+	for i, u := range users {
+		ids[i] = u.UserID
+	}
+	history, err := s.loadPairHistory(ctx, ids)
+	if err != nil {
+		log.Printf("batch matching: pair history: %v", err)
+		return report
 	}
 
-	sort.Slice(pairs, func(i, j int) bool {
-		return pairs[i].Priority > pairs[j].Priority
-	})
+	chosen, strategy, considered := s.cfg.planBatch(users, history)
+	report.Strategy = strategy
+	report.Candidates = considered
 
-	matched := make(map[string]bool)
-	for _, p := range pairs {
-		if matched[p.User1] || matched[p.User2] {
+	var total float64
+	for _, p := range chosen {
+		sessionID, err := s.createSession(ctx, p.User1, loc, p.User2, loc, endsAt, revealAt, p.RadiusKm)
+		if err != nil {
+			log.Printf("batch matching: %v", err)
 			continue
 		}
 
-		var sessionID string
-		err := s.db.QueryRow(ctx,
-			`INSERT INTO chat_sessions (user1_id, user2_id) VALUES ($1, $2) RETURNING id`,
-			p.User1, p.User2).Scan(&sessionID)
-		if err != nil {
-			log.Printf("batch matching: create session: %v", err)
-			continue
+		report.Pairs++
+		total += p.Priority
+		log.Printf("batch matching: matched %s <-> %s within %gkm (session %s)", p.User1, p.User2, p.RadiusKm, sessionID)
+	}
+
+	report.Matched = 2 * report.Pairs
+	report.Unmatched = report.Users - report.Matched
+	if report.Pairs > 0 {
+		report.AvgPriority = total / float64(report.Pairs)
+	}
+	report.Duration = time.Since(start)
+	return report
+}
+
+// planBatch pairs users at the first search radius, then retries those left
+// over at each wider radius in turn. It returns the chosen pairs, the pairing
+// strategy and how many candidate pairs were considered.
+func (c Config) planBatch(users []candidate, history pairHistory) ([]matchCandidate, string, int) {
+	var chosen []matchCandidate
+	strategy := c.Strategy
+	considered := 0
+
+	remaining := users
+	for step, radius := range c.RadiusStepsKm {
+		if len(remaining) < 2 {
+			break
+		}
+		index := make(map[string]int, len(remaining))
+		for i, u := range remaining {
+			index[u.UserID] = i
 		}
 
-		midnight := time.Now().Truncate(24*time.Hour).Add(24 * time.Hour)
-		ttl := time.Until(midnight)
-		s.rdb.Set(ctx, matchKeyForToday(p.User1), sessionID, ttl)
-		s.rdb.Set(ctx, matchKeyForToday(p.User2), sessionID, ttl)
+		pairs := c.candidatePairs(remaining, history, radius)
+		considered += len(pairs)
+		picked, used := c.pair(len(remaining), pairs, index)
+		if step == 0 {
+			strategy = used
+		}
+		chosen = append(chosen, picked...)
 
-		matched[p.User1] = true
-		matched[p.User2] = true
-		log.Printf("batch matching: matched %s <-> %s (session %s)", p.User1, p.User2, sessionID)
+		matched := make(map[string]bool, 2*len(picked))
+		for _, p := range picked {
+			matched[p.User1] = true
+			matched[p.User2] = true
+		}
+		var next []candidate
+		for _, u := range remaining {
+			if !matched[u.UserID] {
+				next = append(next, u)
+			}
+		}
+		remaining = next
 	}
+	return chosen, strategy, considered
+}
+
+// candidatePairs scores every pair of users within radius km of each other,
+// leaving out pairs in history. A spatial grid keeps this close to linear in
+// the number of users for a given density instead of comparing every pair.
+func (c Config) candidatePairs(users []candidate, history pairHistory, radius float64) []matchCandidate {
+	var pairs []matchCandidate
+	newGrid(users, radius).pairsWithin(radius, func(i, j int, dist float64) {
+		if history.has(users[i].UserID, users[j].UserID) || !mutuallyAccept(&users[i], &users[j], dist) {
+			return
+		}
+		pairs = append(pairs, matchCandidate{
+			User1:    users[i].UserID,
+			User2:    users[j].UserID,
+			Priority: c.priority(&users[i], &users[j], dist, radius),
+			RadiusKm: radius,
+		})
+	})
+	return pairs
 }
 
 // haversine calculates the distance in km between two lat/lng points.
@@ -0,0 +1,172 @@
+package matcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/uniqsocial/backend/internal/db/dbtest"
+)
+
+// TestConcurrentMatchingOneSessionPerDay races on-demand finds for every user
+// of a cohort against several batch runs over the same cohort and checks
+// that nobody ends up in two sessions on the same local day.
+func TestConcurrentMatchingOneSessionPerDay(t *testing.T) {
+	pool := dbtest.Postgres(t)
+	rdb := dbtest.Redis(t)
+	ctx := context.Background()
+
+	const (
+		timezone = "Pacific/Chatham"
+		users    = 24
+		batches  = 4
+		rounds   = 5
+	)
+	svc := NewService(pool, rdb, nil, Config{Strategy: StrategyGreedy}, nil)
+
+	for round := 0; round < rounds; round++ {
+		t.Run(fmt.Sprintf("round %d", round), func(t *testing.T) {
+			ids := make([]string, users)
+			for i := range ids {
+				// Everyone is within a few km of everyone else
+				ids[i] = dbtest.CreateUser(t, pool, dbtest.User{
+					Timezone:  timezone,
+					Latitude:  -43.95 + float64(i%6)*0.005,
+					Longitude: -176.55 + float64(i/6)*0.005,
+				})
+				if _, err := svc.joinPool(ctx, ids[i], timezone); err != nil {
+					t.Fatalf("join pool: %v", err)
+				}
+			}
+			t.Cleanup(func() {
+				members := make([]interface{}, len(ids))
+				for i, id := range ids {
+					members[i] = id
+				}
+				rdb.ZRem(ctx, poolKey(timezone, loadLocation(timezone)), members...)
+			})
+
+			start := make(chan struct{})
+			var wg sync.WaitGroup
+			for _, id := range ids {
+				wg.Add(1)
+				go func(id string) {
+					defer wg.Done()
+					<-start
+					// Running out of partners is expected under contention
+					svc.FindMatch(ctx, id)
+				}(id)
+			}
+			for i := 0; i < batches; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					svc.RunBatchMatching(ctx, timezone)
+				}()
+			}
+			close(start)
+			wg.Wait()
+
+			// Besides nobody having two sessions a day, every session must
+			// hold the claims of both its users and every claim must belong
+			// to a session of its user, or the claims prove nothing.
+			var sessions, unclaimed, stray int
+			err := pool.QueryRow(ctx,
+				`SELECT
+				    (SELECT COUNT(*) FROM (
+				        SELECT 1 FROM chat_sessions cs
+				        JOIN users u ON u.id IN (cs.user1_id, cs.user2_id)
+				        WHERE u.id = ANY($1::uuid[]) AND cs.status != 'skipped'
+				        GROUP BY u.id, (cs.started_at AT TIME ZONE u.timezone)::date
+				        HAVING COUNT(*) > 1) s),
+				    (SELECT COUNT(*) FROM chat_sessions cs
+				     WHERE (cs.user1_id = ANY($1::uuid[]) OR cs.user2_id = ANY($1::uuid[]))
+				       AND cs.status != 'skipped'
+				       AND (SELECT COUNT(*) FROM daily_matches dm
+				            WHERE dm.session_id = cs.id AND dm.user_id IN (cs.user1_id, cs.user2_id)) != 2),
+				    (SELECT COUNT(*) FROM daily_matches dm
+				     JOIN chat_sessions cs ON cs.id = dm.session_id
+				     WHERE dm.user_id = ANY($1::uuid[]) AND dm.user_id NOT IN (cs.user1_id, cs.user2_id))`,
+				ids).Scan(&sessions, &unclaimed, &stray)
+			if err != nil {
+				t.Fatalf("check sessions: %v", err)
+			}
+			if sessions > 0 {
+				t.Fatalf("%d users have two sessions in a day", sessions)
+			}
+			if unclaimed > 0 || stray > 0 {
+				t.Fatalf("%d sessions lack their users' daily_matches claims and %d claims point elsewhere", unclaimed, stray)
+			}
+
+			var matched int
+			if err := pool.QueryRow(ctx,
+				`SELECT COUNT(*) FROM daily_matches WHERE user_id = ANY($1::uuid[])`,
+				ids).Scan(&matched); err != nil {
+				t.Fatalf("count matches: %v", err)
+			}
+			if matched == 0 {
+				t.Fatal("nobody was matched")
+			}
+		})
+	}
+}
+
+// proximityRanker ranks pairs by proximity alone, so a pair's priority shows
+// the radius it was scored against.
+type proximityRanker struct{}
+
+func (proximityRanker) Rank(f Features) float64 { return f.Proximity }
+
+func TestPlanBatchWidensRadius(t *testing.T) {
+	// Users along the equator, placed by their distance in km from 0°
+	at := func(id string, km float64, prefs Preferences) candidate {
+		return candidate{UserID: id, Longitude: km / kmPerDegree, Prefs: prefs}
+	}
+	users := []candidate{
+		at("near-a", 0, Preferences{}),
+		at("near-b", 30, Preferences{}),
+		// 80 km apart and far from anyone else: matched at the second step
+		at("isolated-a", 1000, Preferences{}),
+		at("isolated-b", 1080, Preferences{}),
+		// Within the first step, but beyond capped's own max_distance_km
+		at("capped", 2000, Preferences{MaxDistanceKm: floatPtr(20)}),
+		at("capped-partner", 2030, Preferences{}),
+	}
+	byID := make(map[string]*candidate, len(users))
+	for i := range users {
+		byID[users[i].UserID] = &users[i]
+	}
+
+	cfg := Config{
+		Strategy:      StrategyGreedy,
+		RadiusStepsKm: []float64{50, 100, 250},
+		Ranker:        proximityRanker{},
+	}.withDefaults()
+	chosen, _, _ := cfg.planBatch(users, nil)
+
+	want := map[[2]string]float64{
+		pairKey("near-a", "near-b"):         50,
+		pairKey("isolated-a", "isolated-b"): 100,
+	}
+	if len(chosen) != len(want) {
+		t.Fatalf("got %d pairs %v, want %d", len(chosen), chosen, len(want))
+	}
+	for _, p := range chosen {
+		radius, ok := want[pairKey(p.User1, p.User2)]
+		if !ok {
+			t.Fatalf("unexpected pair %s, %s", p.User1, p.User2)
+		}
+		if p.RadiusKm != radius {
+			t.Errorf("%s, %s: RadiusKm = %v, want %v", p.User1, p.User2, p.RadiusKm, radius)
+		}
+
+		a, b := byID[p.User1], byID[p.User2]
+		dist := haversine(a.Latitude, a.Longitude, b.Latitude, b.Longitude)
+		if proximity := 1 - dist/radius; math.Abs(p.Priority-proximity) > 1e-9 {
+			t.Errorf("%s, %s: proximity = %v, want %v scored against %v km", p.User1, p.User2, p.Priority, proximity, radius)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package matcher
+
+import (
+	"fmt"
+	"testing"
+)
+
+// BenchmarkPlanBatch pairs synthetic cohorts spread over a 3000 km square,
+// the in-memory part of RunBatchMatching. Run with
+//
+//	go test ./internal/matcher -run '^$' -bench PlanBatch -benchtime 1x
+//
+// to check that a 100k-user cohort stays within the scheduler's budget.
+func BenchmarkPlanBatch(b *testing.B) {
+	for _, n := range []int{10000, 100000} {
+		users := SyntheticUsers(n, 40, -95, 3000, 1)
+		for _, strategy := range []string{StrategyGreedy, StrategyMaxWeight} {
+			b.Run(fmt.Sprintf("%s/users=%d", strategy, n), func(b *testing.B) {
+				cfg := Config{Strategy: strategy, ExactMaxUsers: 1500}
+				var report BatchReport
+				for i := 0; i < b.N; i++ {
+					report = SimulateBatch(cfg, users)
+				}
+				b.ReportMetric(float64(report.Candidates), "candidates/op")
+				b.ReportMetric(float64(report.Pairs), "pairs/op")
+			})
+		}
+	}
+}
+
+// BenchmarkPairsWithin measures the spatial grid alone at 100k users.
+func BenchmarkPairsWithin(b *testing.B) {
+	synthetic := SyntheticUsers(100000, 40, -95, 3000, 1)
+	users := make([]candidate, len(synthetic))
+	for i, u := range synthetic {
+		users[i] = candidate{UserID: u.ID, Latitude: u.Latitude, Longitude: u.Longitude}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pairs := 0
+		newGrid(users, 50).pairsWithin(50, func(i, j int, dist float64) {
+			pairs++
+		})
+		b.ReportMetric(float64(pairs), "pairs/op")
+	}
+}
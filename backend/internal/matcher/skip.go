@@ -0,0 +1,176 @@
+package matcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/uniqsocial/backend/internal/auth"
+	"github.com/uniqsocial/backend/pkg/response"
+)
+
+var (
+	errNothingToSkip = errors.New("no active match to skip")
+	errNoSkipsLeft   = errors.New("no skips left today")
+)
+
+// SkipResult reports a skipped match, how many more skips the user has today
+// and, when a rematch was asked for, the replacement match if one was found.
+type SkipResult struct {
+	SessionID string
+	SkipsLeft int
+	Match     *MatchResult
+}
+
+// Skip ends a user's active, revealed match as skipped and frees both users'
+// day so that they can be matched again, though never with each other. Each
+// user may skip Config.SkipsPerDay matches a local day. With rematch set,
+// matching is run again straight away for the user, and for the partner if
+// they are still in tonight's active pool.
+func (s *Service) Skip(ctx context.Context, userID string, rematch bool) (*SkipResult, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("skip: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the user's row keeps two concurrent skips from both passing
+	// the quota check
+	var tz string
+	if err := tx.QueryRow(ctx,
+		`SELECT timezone FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&tz); err != nil {
+		return nil, err
+	}
+	today, _ := dayBounds(loadLocation(tz), time.Now())
+
+	var skipped int
+	if err := tx.QueryRow(ctx,
+		`SELECT COUNT(*) FROM chat_sessions
+		 WHERE ended_by = $1 AND status = 'skipped' AND ended_at >= $2`,
+		userID, today).Scan(&skipped); err != nil {
+		return nil, fmt.Errorf("skip: count skips: %w", err)
+	}
+	if skipped >= s.cfg.SkipsPerDay {
+		return nil, errNoSkipsLeft
+	}
+
+	var e MatchSkipped
+	err = tx.QueryRow(ctx,
+		`UPDATE chat_sessions SET status = 'skipped', ended_at = NOW(), ended_by = $1
+		 WHERE (user1_id = $1 OR user2_id = $1)
+		   AND status = 'active' AND reveal_at <= NOW() AND ends_at > NOW()
+		 RETURNING id, user1_id, user2_id`,
+		userID).Scan(&e.SessionID, &e.UserIDs[0], &e.UserIDs[1])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errNothingToSkip
+	}
+	if err != nil {
+		return nil, fmt.Errorf("skip: %w", err)
+	}
+	e.SkippedBy = userID
+
+	// A skipped session does not use up either user's match for the day
+	rows, err := tx.Query(ctx,
+		`DELETE FROM daily_matches WHERE session_id = $1 RETURNING user_id, match_date`,
+		e.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("skip: release match day: %w", err)
+	}
+	var keys []string
+	for rows.Next() {
+		var id string
+		var date time.Time
+		if err := rows.Scan(&id, &date); err != nil {
+			continue
+		}
+		keys = append(keys, matchKey(id, date))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("skip: release match day: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("skip: %w", err)
+	}
+	if len(keys) > 0 {
+		s.rdb.Del(ctx, keys...)
+	}
+
+	// A skip counts against the user who skipped, not as a no-reply
+	s.scoringSvc.RecordSkip(ctx, userID, e.SessionID)
+	s.scoringSvc.ComputeSessionScore(ctx, e.UserIDs[0], e.SessionID)
+	s.scoringSvc.ComputeSessionScore(ctx, e.UserIDs[1], e.SessionID)
+
+	if s.events != nil {
+		s.events.MatchSkipped(ctx, e)
+	}
+
+	result := &SkipResult{SessionID: e.SessionID, SkipsLeft: s.cfg.SkipsPerDay - skipped - 1}
+	if !rematch {
+		return result, nil
+	}
+
+	partnerID := e.UserIDs[0]
+	if partnerID == userID {
+		partnerID = e.UserIDs[1]
+	}
+	if match, err := s.FindMatch(ctx, userID); err == nil {
+		result.Match = match
+	}
+	// The partner did not ask for this, so they are not opted back in
+	if _, err := s.findMatch(ctx, partnerID, false); err != nil && !errors.Is(err, errNotInPool) {
+		log.Printf("matcher: rematch after skip: %v", err)
+	}
+	return result, nil
+}
+
+type SkipRequest struct {
+	Rematch bool `json:"rematch"`
+}
+
+func (h *Handler) Skip(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+
+	// The body is optional; without one the match is skipped without a rematch
+	var req SkipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	result, err := h.svc.Skip(r.Context(), userID, req.Rematch)
+	switch {
+	case errors.Is(err, errNothingToSkip):
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, errNoSkipsLeft):
+		response.Error(w, http.StatusTooManyRequests, err.Error())
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		response.Error(w, http.StatusNotFound, "user not found")
+		return
+	case err != nil:
+		response.Error(w, http.StatusInternalServerError, "failed to skip match")
+		return
+	}
+
+	resp := map[string]interface{}{
+		"skipped":    true,
+		"session_id": result.SessionID,
+		"skips_left": result.SkipsLeft,
+		"matched":    false,
+	}
+	if result.Match != nil {
+		for k, v := range matchResponse(result.Match) {
+			resp[k] = v
+		}
+	}
+	response.JSON(w, http.StatusOK, resp)
+}
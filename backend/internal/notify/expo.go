@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// expoPushURL is the Expo push API endpoint.
+const expoPushURL = "https://exp.host/--/api/v2/push/send"
+
+// expoBatchSize is the most messages Expo accepts in one request.
+const expoBatchSize = 100
+
+// ExpoNotifier sends through the Expo push service, which forwards to APNs
+// and FCM. It only delivers to Expo push tokens; any other device is logged
+// and skipped.
+type ExpoNotifier struct {
+	url         string
+	accessToken string
+	client      *http.Client
+}
+
+// NewExpoNotifier returns an ExpoNotifier. accessToken is only needed when
+// enhanced push security is enabled for the Expo project.
+func NewExpoNotifier(accessToken string) *ExpoNotifier {
+	return &ExpoNotifier{
+		url:         expoPushURL,
+		accessToken: accessToken,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type expoMessage struct {
+	To    string            `json:"to"`
+	Title string            `json:"title,omitempty"`
+	Body  string            `json:"body,omitempty"`
+	Data  map[string]string `json:"data,omitempty"`
+	Sound string            `json:"sound,omitempty"`
+}
+
+type expoTicket struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Details struct {
+		Error string `json:"error"`
+	} `json:"details"`
+}
+
+// Send posts the messages in batches of expoBatchSize. A failed batch does not
+// stop the ones after it; its error is joined with any UnregisteredError.
+func (n *ExpoNotifier) Send(ctx context.Context, msgs []Message) error {
+	var batch []expoMessage
+	for _, msg := range msgs {
+		for _, d := range msg.To {
+			if d.Provider != ProviderExpo {
+				log.Printf("notify: cannot deliver to %s device through expo", d.Provider)
+				continue
+			}
+			batch = append(batch, expoMessage{To: d.Token, Title: msg.Title, Body: msg.Body, Data: msg.Data, Sound: "default"})
+		}
+	}
+
+	var errs []error
+	var unregistered []string
+	for start := 0; start < len(batch); start += expoBatchSize {
+		end := min(start+expoBatchSize, len(batch))
+		tickets, err := n.post(ctx, batch[start:end])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// Tickets are returned in the order of the messages sent
+		for i, t := range tickets {
+			if t.Status == "error" && t.Details.Error == "DeviceNotRegistered" && start+i < end {
+				unregistered = append(unregistered, batch[start+i].To)
+			}
+		}
+	}
+
+	if len(unregistered) > 0 {
+		errs = append(errs, &UnregisteredError{Tokens: unregistered})
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+func (n *ExpoNotifier) post(ctx context.Context, batch []expoMessage) ([]expoTicket, error) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if n.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+n.accessToken)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("expo push: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("expo push: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data []expoTicket `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("expo push: decode response: %w", err)
+	}
+	return result.Data, nil
+}
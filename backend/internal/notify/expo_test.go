@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestExpoNotifierSendsEveryBatch(t *testing.T) {
+	// The second of three batches fails; the first and last each report one
+	// unregistered token
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		var batch []expoMessage
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if n == 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		tickets := make([]map[string]interface{}, len(batch))
+		for i := range batch {
+			tickets[i] = map[string]interface{}{"status": "ok"}
+		}
+		tickets[0] = map[string]interface{}{
+			"status":  "error",
+			"details": map[string]string{"error": "DeviceNotRegistered"},
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": tickets})
+	}))
+	defer srv.Close()
+
+	n := &ExpoNotifier{url: srv.URL, client: srv.Client()}
+	msgs := make([]Message, 2*expoBatchSize+expoBatchSize/2)
+	for i := range msgs {
+		msgs[i] = Message{To: []Device{{Provider: ProviderExpo, Token: fmt.Sprintf("token-%d", i)}}, Title: "Hi"}
+	}
+
+	err := n.Send(context.Background(), msgs)
+	if got := requests.Load(); got != 3 {
+		t.Errorf("sent %d requests, want 3", got)
+	}
+
+	var unregistered *UnregisteredError
+	if !errors.As(err, &unregistered) {
+		t.Fatalf("Send = %v, want an UnregisteredError", err)
+	}
+	want := []string{"token-0", fmt.Sprintf("token-%d", 2*expoBatchSize)}
+	if fmt.Sprint(unregistered.Tokens) != fmt.Sprint(want) {
+		t.Errorf("unregistered tokens = %v, want %v", unregistered.Tokens, want)
+	}
+	if err == unregistered {
+		t.Error("the failed batch's error was dropped")
+	}
+}
@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/uniqsocial/backend/internal/auth"
+	"github.com/uniqsocial/backend/pkg/response"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+type RegisterDeviceRequest struct {
+	Token    string `json:"token"`
+	Provider string `json:"provider"`
+	Platform string `json:"platform"`
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+// RegisterDevice stores a push token for the signed-in user.
+func (h *Handler) RegisterDevice(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+
+	var req RegisterDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" {
+		response.Error(w, http.StatusBadRequest, "token is required")
+		return
+	}
+	if len(req.Token) > 4096 {
+		response.Error(w, http.StatusBadRequest, "token is too long")
+		return
+	}
+	if req.Provider != ProviderExpo {
+		response.Error(w, http.StatusBadRequest, "provider must be expo")
+		return
+	}
+	switch req.Platform {
+	case "", "ios", "android":
+	default:
+		response.Error(w, http.StatusBadRequest, "platform must be ios or android")
+		return
+	}
+
+	if err := h.svc.RegisterDevice(r.Context(), userID, req.Provider, req.Token, req.Platform); err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to register device")
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, map[string]string{"status": "registered"})
+}
+
+// UnregisterDevice removes one of the signed-in user's push tokens, for
+// example on sign out.
+func (h *Handler) UnregisterDevice(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+
+	if err := h.svc.UnregisterDevice(r.Context(), userID, chi.URLParam(r, "token")); err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to unregister device")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"status": "unregistered"})
+}
@@ -0,0 +1,21 @@
+package notify
+
+import (
+	"context"
+	"log"
+)
+
+// LogNotifier is a Notifier for local development that writes each message
+// to the log instead of pushing it.
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Send(ctx context.Context, msgs []Message) error {
+	for _, msg := range msgs {
+		log.Printf("notify: %d devices: %s: %s", len(msg.To), msg.Title, msg.Body)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package notify
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryNotifier is a Notifier for tests. It records every message in memory
+// instead of pushing it, so it must not be used in a long-running server.
+type MemoryNotifier struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryNotifier() *MemoryNotifier {
+	return &MemoryNotifier{}
+}
+
+func (n *MemoryNotifier) Send(ctx context.Context, msgs []Message) error {
+	n.mu.Lock()
+	n.messages = append(n.messages, msgs...)
+	n.mu.Unlock()
+	return nil
+}
+
+// Messages returns every message sent so far.
+func (n *MemoryNotifier) Messages() []Message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Message(nil), n.messages...)
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+)
+
+// ProviderExpo marks an Expo push token, the only kind of device token that
+// can be registered until there is a sender for raw APNs or FCM tokens.
+const ProviderExpo = "expo"
+
+// Device is a registered push token.
+type Device struct {
+	Provider string
+	Token    string
+}
+
+// Message is a push notification for one or more devices.
+type Message struct {
+	To    []Device
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// Notifier delivers push notifications, several at a time so it can batch
+// them into as few requests as its provider allows.
+type Notifier interface {
+	Send(ctx context.Context, msgs []Message) error
+}
+
+// UnregisteredError is returned by a Notifier when some tokens are no longer
+// valid, so they can be forgotten. The other devices were still notified,
+// unless it comes joined with the errors of sends that failed.
+type UnregisteredError struct {
+	Tokens []string
+}
+
+func (e *UnregisteredError) Error() string {
+	return fmt.Sprintf("%d device tokens are no longer registered", len(e.Tokens))
+}
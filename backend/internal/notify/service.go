@@ -0,0 +1,216 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/uniqsocial/backend/internal/matcher"
+)
+
+// sendTimeout bounds how long sending one batch may take.
+const sendTimeout = 30 * time.Second
+
+// Notifications are queued and sent in batches of up to maxBatch, at most
+// flushInterval after the first of them was queued, so a cohort reveal does
+// not turn into one request per user.
+const (
+	queueSize     = 10000
+	maxBatch      = 500
+	flushInterval = time.Second
+)
+
+// messageCooldown is the least time between two new-message notifications
+// for the same user and session.
+const messageCooldown = 5 * time.Minute
+
+// notification is a queued push for every device of one user.
+type notification struct {
+	userID string
+	title  string
+	body   string
+	data   map[string]string
+}
+
+// Service keeps the device registry and pushes notifications to users. It
+// also receives the matcher's events.
+type Service struct {
+	db       *pgxpool.Pool
+	rdb      *redis.Client
+	notifier Notifier
+	queue    chan notification
+}
+
+func NewService(db *pgxpool.Pool, rdb *redis.Client, notifier Notifier) *Service {
+	return &Service{db: db, rdb: rdb, notifier: notifier, queue: make(chan notification, queueSize)}
+}
+
+// RegisterDevice records a push token for a user. A token registered by
+// another user before, such as after signing out on a shared phone, moves to
+// this user.
+func (s *Service) RegisterDevice(ctx context.Context, userID, provider, token, platform string) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO devices (user_id, provider, token, platform)
+		 VALUES ($1, $2, $3, NULLIF($4, ''))
+		 ON CONFLICT (token) DO UPDATE SET
+		    user_id = EXCLUDED.user_id, provider = EXCLUDED.provider,
+		    platform = EXCLUDED.platform, last_seen_at = NOW()`,
+		userID, provider, token, platform)
+	return err
+}
+
+// UnregisterDevice forgets one of a user's push tokens.
+func (s *Service) UnregisterDevice(ctx context.Context, userID, token string) error {
+	_, err := s.db.Exec(ctx,
+		`DELETE FROM devices WHERE user_id = $1 AND token = $2`, userID, token)
+	return err
+}
+
+// NotifyUser queues a notification to every device of a user. It never
+// blocks; when the queue is full the notification is dropped.
+func (s *Service) NotifyUser(userID, title, body string, data map[string]string) {
+	select {
+	case s.queue <- notification{userID: userID, title: title, body: body, data: data}:
+	default:
+		log.Printf("notify: queue full, dropping notification for %s", userID)
+	}
+}
+
+// Start sends queued notifications in batches until ctx is done.
+func (s *Service) Start(ctx context.Context) {
+	var batch []notification
+	var flush <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-s.queue:
+			if len(batch) == 0 {
+				flush = time.After(flushInterval)
+			}
+			batch = append(batch, n)
+			if len(batch) < maxBatch {
+				continue
+			}
+		case <-flush:
+		}
+
+		s.send(batch)
+		batch, flush = nil, nil
+	}
+}
+
+// send pushes a batch of notifications in one go, forgetting tokens the
+// provider reports as unregistered.
+func (s *Service) send(batch []notification) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	userIDs := make([]string, len(batch))
+	for i, n := range batch {
+		userIDs[i] = n.userID
+	}
+	devices, err := s.devices(ctx, userIDs)
+	if err != nil {
+		log.Printf("notify: load devices: %v", err)
+		return
+	}
+
+	var msgs []Message
+	for _, n := range batch {
+		if to := devices[n.userID]; len(to) > 0 {
+			msgs = append(msgs, Message{To: to, Title: n.title, Body: n.body, Data: n.data})
+		}
+	}
+	if len(msgs) == 0 {
+		return
+	}
+
+	err = s.notifier.Send(ctx, msgs)
+	var unregistered *UnregisteredError
+	if errors.As(err, &unregistered) {
+		if _, err := s.db.Exec(ctx, `DELETE FROM devices WHERE token = ANY($1)`, unregistered.Tokens); err != nil {
+			log.Printf("notify: forget unregistered devices: %v", err)
+		}
+		if err == unregistered {
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("notify: send %d notifications: %v", len(msgs), err)
+	}
+}
+
+// devices returns the registered devices of the given users, by user.
+func (s *Service) devices(ctx context.Context, userIDs []string) (map[string][]Device, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT user_id, provider, token FROM devices WHERE user_id = ANY($1::uuid[])`, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := make(map[string][]Device)
+	for rows.Next() {
+		var userID string
+		var d Device
+		if err := rows.Scan(&userID, &d.Provider, &d.Token); err != nil {
+			continue
+		}
+		devices[userID] = append(devices[userID], d)
+	}
+	return devices, rows.Err()
+}
+
+// MatchCreated tells both users about their new match.
+func (s *Service) MatchCreated(ctx context.Context, e matcher.MatchCreated) {
+	for _, userID := range e.UserIDs {
+		s.NotifyUser(userID, "You have a new match", "Say hi before the night is over",
+			map[string]string{"type": "match_created", "session_id": e.SessionID})
+	}
+}
+
+// WindowClosing warns both users that their chat is about to end.
+func (s *Service) WindowClosing(ctx context.Context, e matcher.WindowClosing) {
+	minutes := int(time.Until(e.EndsAt).Round(time.Minute).Minutes())
+	for _, userID := range e.UserIDs {
+		s.NotifyUser(userID, "Your chat is closing soon",
+			fmt.Sprintf("Tonight's chat ends in %d minutes", minutes),
+			map[string]string{"type": "window_closing", "session_id": e.SessionID})
+	}
+}
+
+// MatchSkipped tells the user whose match was skipped that tonight's chat is
+// over.
+func (s *Service) MatchSkipped(ctx context.Context, e matcher.MatchSkipped) {
+	for _, userID := range e.UserIDs {
+		if userID == e.SkippedBy {
+			continue
+		}
+		s.NotifyUser(userID, "Your match moved on", "Tonight's chat was skipped",
+			map[string]string{"type": "match_skipped", "session_id": e.SessionID})
+	}
+}
+
+// NewMessage tells a user who is not in the chat that their match wrote to
+// them, at most once per messageCooldown for each session.
+func (s *Service) NewMessage(ctx context.Context, userID, sessionID string) {
+	key := fmt.Sprintf("notify:message:%s:%s", sessionID, userID)
+	if ok, err := s.rdb.SetNX(ctx, key, 1, messageCooldown).Result(); err != nil || !ok {
+		return
+	}
+	s.NotifyUser(userID, "New message", "Your match sent you a message",
+		map[string]string{"type": "message", "session_id": sessionID})
+}
+
+// PartnerEndedChat tells a user their match ended the chat.
+func (s *Service) PartnerEndedChat(ctx context.Context, userID, sessionID string) {
+	s.NotifyUser(userID, "Chat ended", "Your match ended tonight's chat",
+		map[string]string{"type": "chat_ended", "session_id": sessionID})
+}
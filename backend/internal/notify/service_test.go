@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/uniqsocial/backend/internal/db/dbtest"
+	"github.com/uniqsocial/backend/internal/matcher"
+)
+
+// waitForMessages waits until the notifier has recorded n messages, since
+// the service sends in the background, and checks no more arrive.
+func waitForMessages(t *testing.T, n *MemoryNotifier, count int) []Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(n.Messages()) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d messages, want %d", len(n.Messages()), count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	msgs := n.Messages()
+	if len(msgs) != count {
+		t.Fatalf("got %d messages, want %d", len(msgs), count)
+	}
+	return msgs
+}
+
+// sentTo returns the messages of the given type sent to a token.
+func sentTo(msgs []Message, token, kind string) []Message {
+	var found []Message
+	for _, m := range msgs {
+		for _, d := range m.To {
+			if d.Token == token && m.Data["type"] == kind {
+				found = append(found, m)
+			}
+		}
+	}
+	return found
+}
+
+func TestServiceNotifications(t *testing.T) {
+	pool := dbtest.Postgres(t)
+	rdb := dbtest.Redis(t)
+	ctx := context.Background()
+
+	notifier := NewMemoryNotifier()
+	svc := NewService(pool, rdb, notifier)
+	sendCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go svc.Start(sendCtx)
+
+	alice := dbtest.CreateUser(t, pool, dbtest.User{})
+	bob := dbtest.CreateUser(t, pool, dbtest.User{})
+	carol := dbtest.CreateUser(t, pool, dbtest.User{}) // has no devices
+
+	aliceToken := "ExponentPushToken[" + alice + "]"
+	bobToken := "ExponentPushToken[" + bob + "]"
+	if err := svc.RegisterDevice(ctx, alice, ProviderExpo, aliceToken, "ios"); err != nil {
+		t.Fatalf("register device: %v", err)
+	}
+	if err := svc.RegisterDevice(ctx, bob, ProviderExpo, bobToken, "android"); err != nil {
+		t.Fatalf("register device: %v", err)
+	}
+
+	// Session ids only key the cooldown and label the data, so any unique
+	// value will do
+	session := "session-" + alice
+	otherSession := "session-" + bob
+
+	t.Run("match created", func(t *testing.T) {
+		svc.MatchCreated(ctx, matcher.MatchCreated{SessionID: session, UserIDs: [2]string{alice, bob}})
+		msgs := waitForMessages(t, notifier, 2)
+		for _, token := range []string{aliceToken, bobToken} {
+			got := sentTo(msgs, token, "match_created")
+			if len(got) != 1 {
+				t.Fatalf("%s got %d match_created messages, want 1", token, len(got))
+			}
+			if got[0].Data["session_id"] != session {
+				t.Errorf("session_id = %q, want %q", got[0].Data["session_id"], session)
+			}
+		}
+	})
+
+	t.Run("new message cooldown", func(t *testing.T) {
+		svc.NewMessage(ctx, bob, session)
+		svc.NewMessage(ctx, bob, session)      // within the cooldown
+		svc.NewMessage(ctx, bob, otherSession) // another session has its own
+		svc.NewMessage(ctx, carol, session)    // no devices
+		msgs := waitForMessages(t, notifier, 4)
+		if got := sentTo(msgs, bobToken, "message"); len(got) != 2 {
+			t.Fatalf("bob got %d message notifications, want 2", len(got))
+		}
+		if ttl := rdb.TTL(ctx, "notify:message:"+session+":"+bob).Val(); ttl <= 0 || ttl > messageCooldown {
+			t.Errorf("cooldown ttl = %s, want up to %s", ttl, messageCooldown)
+		}
+	})
+
+	t.Run("partner ended chat", func(t *testing.T) {
+		svc.PartnerEndedChat(ctx, alice, session)
+		msgs := waitForMessages(t, notifier, 5)
+		got := sentTo(msgs, aliceToken, "chat_ended")
+		if len(got) != 1 {
+			t.Fatalf("alice got %d chat_ended messages, want 1", len(got))
+		}
+		if len(sentTo(msgs, bobToken, "chat_ended")) != 0 {
+			t.Error("the user who ended the chat was notified")
+		}
+	})
+}
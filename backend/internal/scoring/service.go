@@ -50,6 +50,17 @@ func (s *Service) RecordEndChat(ctx context.Context, userID, sessionID string) {
 	}
 }
 
+// RecordSkip records that a user skipped their match in a session.
+func (s *Service) RecordSkip(ctx context.Context, userID, sessionID string) {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO behavior_events (user_id, session_id, event_type)
+		 VALUES ($1, $2, 'skip')`,
+		userID, sessionID)
+	if err != nil {
+		log.Printf("scoring: record skip: %v", err)
+	}
+}
+
 // ComputeSessionScore computes the engagement score update for a user after a chat session ends.
 func (s *Service) ComputeSessionScore(ctx context.Context, userID, sessionID string) {
 	var msgCount int
@@ -85,6 +96,12 @@ func (s *Service) ComputeSessionScore(ctx context.Context, userID, sessionID str
 		 WHERE user_id = $1 AND session_id = $2 AND event_type = 'end_chat'`,
 		userID, sessionID).Scan(&endedClean)
 
+	var skipCount int
+	_ = s.db.QueryRow(ctx,
+		`SELECT COUNT(*) FROM behavior_events
+		 WHERE user_id = $1 AND session_id = $2 AND event_type = 'skip'`,
+		userID, sessionID).Scan(&skipCount)
+
 	// Compute delta score
 	delta := 0.0
 
@@ -127,6 +144,11 @@ func (s *Service) ComputeSessionScore(ctx context.Context, userID, sessionID str
 		delta -= float64(noReplyCount) * 10.0
 	}
 
+	// Skip penalty: lighter than a no-reply, since the user declined openly
+	if skipCount > 0 {
+		delta -= float64(skipCount) * 3.0
+	}
+
 	// Clean end bonus
 	if endedClean {
 		delta += 1.0
@@ -147,6 +169,36 @@ func (s *Service) ComputeSessionScore(ctx context.Context, userID, sessionID str
 	}
 }
 
+// FeedbackValue is a SQL expression scoring one session_feedback row from 0
+// to 1: the rating scaled to 0–1, averaged with whether the rater would chat
+// again.
+const FeedbackValue = `((rating - 1) / 4.0 + CASE WHEN would_chat_again THEN 1 ELSE 0 END) / 2`
+
+// feedbackPrior is how many neutral ratings a user's reception starts with,
+// so a single rating cannot swing it to either extreme.
+const feedbackPrior = 3
+
+// UpdateReception recomputes how well a user's chats are received from the
+// feedback their partners left: the mean of each rating scaled to 0–1 and
+// whether the partner would chat again, smoothed towards 0.5.
+func (s *Service) UpdateReception(ctx context.Context, userID string) {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO feedback_scores (user_id, reception, feedback_count)
+		 SELECT $1::uuid,
+		        (COALESCE(SUM(`+FeedbackValue+`), 0) + 0.5 * $2::float8)
+		            / (COUNT(*) + $2::float8),
+		        COUNT(*)
+		 FROM session_feedback WHERE to_user_id = $1
+		 ON CONFLICT (user_id) DO UPDATE SET
+		    reception = EXCLUDED.reception,
+		    feedback_count = EXCLUDED.feedback_count,
+		    updated_at = NOW()`,
+		userID, feedbackPrior)
+	if err != nil {
+		log.Printf("scoring: update reception: %v", err)
+	}
+}
+
 // ApplyInactivityPenalty applies penalty to users who had no messages in a session.
 func (s *Service) ApplyInactivityPenalty(ctx context.Context, sessionID string) {
 	rows, err := s.db.Query(ctx,
@@ -0,0 +1,228 @@
+package user
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/uniqsocial/backend/internal/auth"
+	"github.com/uniqsocial/backend/pkg/response"
+)
+
+// SessionRevoker signs a user out of every device.
+type SessionRevoker interface {
+	RevokeAllSessions(ctx context.Context, userID string) error
+}
+
+// DeleteMe schedules the account for deletion after the grace period, ends any
+// active chat and signs the user out everywhere. Logging in again before the
+// grace period is over cancels the deletion.
+func (h *Handler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+
+	var deleteAt time.Time
+	err := h.db.QueryRow(r.Context(),
+		`UPDATE users SET deletion_requested_at = COALESCE(deletion_requested_at, NOW()), updated_at = NOW()
+		 WHERE id = $1
+		 RETURNING deletion_requested_at + $2::interval`,
+		userID, h.deletionGrace).Scan(&deleteAt)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to delete account")
+		return
+	}
+
+	_, _ = h.db.Exec(r.Context(),
+		`UPDATE chat_sessions SET status = 'ended_by_user', ended_at = NOW(), ended_by = $1
+		 WHERE (user1_id = $1 OR user2_id = $1) AND status IN ('active', 'connected')`,
+		userID)
+
+	if err := h.sessions.RevokeAllSessions(r.Context(), userID); err != nil {
+		log.Printf("user: revoke sessions on delete: %v", err)
+	}
+
+	response.JSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":    "deletion_scheduled",
+		"delete_at": deleteAt,
+	})
+}
+
+// exportSections lists the exported tables in archive order, each with a query
+// returning a single JSON value for the user in $1. Secrets such as password
+// and TOTP hashes and push tokens are left out.
+var exportSections = []struct {
+	name  string
+	table string
+	query string
+}{
+	{"user", "users", `SELECT row_to_json(u) FROM (
+		SELECT id, email, username, photo_url, interests, latitude, longitude, city, timezone,
+		       email_verified_at, deletion_requested_at, created_at, updated_at
+		FROM users WHERE id = $1) u`},
+	{"user_profile", "user_profiles", `SELECT row_to_json(p) FROM user_profiles p WHERE p.user_id = $1`},
+	{"identities", "user_identities", `SELECT COALESCE(json_agg(ui ORDER BY ui.created_at), '[]'::json)
+		FROM user_identities ui WHERE ui.user_id = $1`},
+	{"match_preferences", "match_preferences", `SELECT row_to_json(mp) FROM match_preferences mp WHERE mp.user_id = $1`},
+	{"devices", "devices", `SELECT COALESCE(json_agg(d ORDER BY d.created_at), '[]'::json) FROM (
+		SELECT id, provider, platform, created_at, last_seen_at
+		FROM devices WHERE user_id = $1) d`},
+	{"chat_sessions", "chat_sessions", `SELECT COALESCE(json_agg(cs ORDER BY cs.started_at), '[]'::json)
+		FROM chat_sessions cs WHERE cs.user1_id = $1 OR cs.user2_id = $1`},
+	{"messages", "messages", `SELECT COALESCE(json_agg(m ORDER BY m.created_at), '[]'::json)
+		FROM messages m WHERE m.sender_id = $1`},
+	{"session_feedback", "session_feedback", `SELECT COALESCE(json_agg(sf ORDER BY sf.created_at), '[]'::json)
+		FROM session_feedback sf WHERE sf.from_user_id = $1`},
+	{"behavior_events", "behavior_events", `SELECT COALESCE(json_agg(be ORDER BY be.created_at), '[]'::json)
+		FROM behavior_events be WHERE be.user_id = $1`},
+	{"engagement_scores", "engagement_scores", `SELECT row_to_json(es) FROM engagement_scores es WHERE es.user_id = $1`},
+	{"feedback_scores", "feedback_scores", `SELECT row_to_json(fs) FROM feedback_scores fs WHERE fs.user_id = $1`},
+}
+
+// exportExempt lists the tables referencing users that the export leaves out,
+// with the reason.
+var exportExempt = map[string]string{
+	"refresh_tokens":      "sign-in credentials",
+	"password_resets":     "sign-in credentials",
+	"email_verifications": "sign-in credentials",
+	"recovery_codes":      "sign-in credentials",
+	"daily_matches":       "repeats the user's chat sessions",
+}
+
+// Export returns everything stored about the current user, as one JSON
+// document or, with ?format=zip, as a ZIP archive with one file per table.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserID(r.Context())
+
+	data := make(map[string]json.RawMessage, len(exportSections))
+	for _, section := range exportSections {
+		var raw json.RawMessage
+		err := h.db.QueryRow(r.Context(), section.query, userID).Scan(&raw)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			response.Error(w, http.StatusInternalServerError, "failed to export data")
+			return
+		}
+		if raw == nil {
+			raw = json.RawMessage("null")
+		}
+		data[section.name] = raw
+	}
+
+	filename := fmt.Sprintf("uniqsocial-export-%s", time.Now().UTC().Format("2006-01-02"))
+
+	if r.URL.Query().Get("format") != "zip" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		response.JSON(w, http.StatusOK, map[string]interface{}{
+			"exported_at": time.Now().UTC(),
+			"data":        data,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	for _, section := range exportSections {
+		f, err := zw.Create(section.name + ".json")
+		if err != nil {
+			log.Printf("user: export zip: %v", err)
+			return
+		}
+		f.Write(data[section.name])
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("user: export zip: %v", err)
+	}
+}
+
+// redactedMessage replaces the content of a purged user's messages.
+const redactedMessage = "Message deleted"
+
+// Purger permanently deletes accounts whose deletion grace period is over.
+// Their chat sessions and messages stay behind for their partners, detached
+// from the deleted account and with the deleted user's messages redacted.
+type Purger struct {
+	db    *pgxpool.Pool
+	grace time.Duration
+}
+
+func NewPurger(db *pgxpool.Pool, grace time.Duration) *Purger {
+	return &Purger{db: db, grace: grace}
+}
+
+func (p *Purger) Start(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	p.purge(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.purge(ctx)
+		}
+	}
+}
+
+func (p *Purger) purge(ctx context.Context) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		log.Printf("user: purge deleted accounts: %v", err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the accounts keeps a login from cancelling the deletion of
+	// an account whose messages are already redacted
+	rows, err := tx.Query(ctx,
+		`SELECT id FROM users
+		 WHERE deletion_requested_at IS NOT NULL
+		   AND deletion_requested_at < NOW() - $1::interval
+		 FOR UPDATE`,
+		p.grace)
+	if err != nil {
+		log.Printf("user: purge deleted accounts: %v", err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return
+	}
+
+	// Redact first, while the messages still point at their sender
+	if _, err := tx.Exec(ctx,
+		`UPDATE messages SET content = $2 WHERE sender_id = ANY($1)`,
+		ids, redactedMessage); err != nil {
+		log.Printf("user: redact messages of deleted accounts: %v", err)
+		return
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM users WHERE id = ANY($1)`, ids)
+	if err != nil {
+		log.Printf("user: purge deleted accounts: %v", err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("user: purge deleted accounts: %v", err)
+		return
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		log.Printf("user: purged %d deleted accounts", n)
+	}
+}
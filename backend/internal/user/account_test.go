@@ -0,0 +1,57 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/uniqsocial/backend/internal/db/dbtest"
+)
+
+// TestExportCoversUserTables fails when a table with a foreign key to users
+// is neither exported nor listed as exempt.
+func TestExportCoversUserTables(t *testing.T) {
+	pool := dbtest.Postgres(t)
+
+	rows, err := pool.Query(context.Background(),
+		`SELECT DISTINCT conrelid::regclass::text FROM pg_constraint
+		 WHERE contype = 'f' AND confrelid = 'users'::regclass`)
+	if err != nil {
+		t.Fatalf("list tables referencing users: %v", err)
+	}
+	defer rows.Close()
+
+	exported := make(map[string]bool, len(exportSections))
+	for _, section := range exportSections {
+		exported[section.table] = true
+	}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatalf("scan table: %v", err)
+		}
+		if _, exempt := exportExempt[table]; !exported[table] && !exempt {
+			t.Errorf("table %s references users but is missing from the export", table)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("list tables referencing users: %v", err)
+	}
+}
+
+func TestExportSectionQueries(t *testing.T) {
+	pool := dbtest.Postgres(t)
+	userID := dbtest.CreateUser(t, pool, dbtest.User{})
+
+	for _, section := range exportSections {
+		t.Run(section.name, func(t *testing.T) {
+			var raw []byte
+			err := pool.QueryRow(context.Background(), section.query, userID).Scan(&raw)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				t.Fatalf("query: %v", err)
+			}
+		})
+	}
+}
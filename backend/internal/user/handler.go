@@ -13,12 +13,15 @@ import (
 )
 
 type Handler struct {
-	db *pgxpool.Pool
+	db            *pgxpool.Pool
+	sessions      SessionRevoker
+	deletionGrace time.Duration
 }
 
 type UserProfile struct {
 	ID               string    `json:"id"`
 	Email            string    `json:"email"`
+	EmailVerified    bool      `json:"email_verified"`
 	Username         string    `json:"username"`
 	PhotoURL         *string   `json:"photo_url"`
 	Interests        []string  `json:"interests"`
@@ -42,8 +45,8 @@ type updateLocationRequest struct {
 	Timezone  string  `json:"timezone"`
 }
 
-func NewHandler(db *pgxpool.Pool) *Handler {
-	return &Handler{db: db}
+func NewHandler(db *pgxpool.Pool, sessions SessionRevoker, deletionGrace time.Duration) *Handler {
+	return &Handler{db: db, sessions: sessions, deletionGrace: deletionGrace}
 }
 
 func (h *Handler) GetMe(w http.ResponseWriter, r *http.Request) {
@@ -52,13 +55,13 @@ func (h *Handler) GetMe(w http.ResponseWriter, r *http.Request) {
 	var p UserProfile
 	var interests json.RawMessage
 	err := h.db.QueryRow(context.Background(),
-		`SELECT u.id, u.email, u.username, u.photo_url, u.interests, u.city,
+		`SELECT u.id, u.email, u.email_verified_at IS NOT NULL, u.username, u.photo_url, u.interests, u.city,
 		        u.latitude, u.longitude, u.created_at,
 		        COALESCE(up.profile_completed, false)
 		 FROM users u
 		 LEFT JOIN user_profiles up ON up.user_id = u.id
 		 WHERE u.id = $1`, userID,
-	).Scan(&p.ID, &p.Email, &p.Username, &p.PhotoURL, &interests, &p.City, &p.Latitude, &p.Longitude, &p.CreatedAt, &p.ProfileCompleted)
+	).Scan(&p.ID, &p.Email, &p.EmailVerified, &p.Username, &p.PhotoURL, &interests, &p.City, &p.Latitude, &p.Longitude, &p.CreatedAt, &p.ProfileCompleted)
 
 	if err != nil {
 		response.Error(w, http.StatusNotFound, "user not found")
@@ -134,6 +137,11 @@ func (h *Handler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
 	if tz == "" {
 		tz = "UTC"
 	}
+	// Matching windows are computed in this zone, so it must be a real IANA name
+	if _, err := time.LoadLocation(tz); err != nil || tz == "Local" {
+		response.Error(w, http.StatusBadRequest, "invalid timezone")
+		return
+	}
 
 	_, err := h.db.Exec(context.Background(),
 		`UPDATE users SET latitude = $1, longitude = $2, city = $3, timezone = $4, updated_at = NOW()
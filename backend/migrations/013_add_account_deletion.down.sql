@@ -0,0 +1,20 @@
+DELETE FROM messages WHERE sender_id IS NULL;
+DELETE FROM chat_sessions WHERE user1_id IS NULL OR user2_id IS NULL;
+
+ALTER TABLE messages
+    DROP CONSTRAINT messages_sender_id_fkey,
+    ADD CONSTRAINT messages_sender_id_fkey FOREIGN KEY (sender_id) REFERENCES users(id),
+    ALTER COLUMN sender_id SET NOT NULL;
+
+ALTER TABLE chat_sessions
+    DROP CONSTRAINT chat_sessions_user1_id_fkey,
+    DROP CONSTRAINT chat_sessions_user2_id_fkey,
+    DROP CONSTRAINT chat_sessions_ended_by_fkey,
+    ADD CONSTRAINT chat_sessions_user1_id_fkey FOREIGN KEY (user1_id) REFERENCES users(id),
+    ADD CONSTRAINT chat_sessions_user2_id_fkey FOREIGN KEY (user2_id) REFERENCES users(id),
+    ADD CONSTRAINT chat_sessions_ended_by_fkey FOREIGN KEY (ended_by) REFERENCES users(id),
+    ALTER COLUMN user1_id SET NOT NULL,
+    ALTER COLUMN user2_id SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_users_deletion_requested;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_requested_at;
@@ -0,0 +1,20 @@
+ALTER TABLE users ADD COLUMN deletion_requested_at TIMESTAMPTZ;
+
+CREATE INDEX idx_users_deletion_requested ON users(deletion_requested_at) WHERE deletion_requested_at IS NOT NULL;
+
+-- Deleting a user keeps their partners' chat history but detaches it from
+-- the deleted account.
+ALTER TABLE chat_sessions
+    ALTER COLUMN user1_id DROP NOT NULL,
+    ALTER COLUMN user2_id DROP NOT NULL,
+    DROP CONSTRAINT chat_sessions_user1_id_fkey,
+    DROP CONSTRAINT chat_sessions_user2_id_fkey,
+    DROP CONSTRAINT chat_sessions_ended_by_fkey,
+    ADD CONSTRAINT chat_sessions_user1_id_fkey FOREIGN KEY (user1_id) REFERENCES users(id) ON DELETE SET NULL,
+    ADD CONSTRAINT chat_sessions_user2_id_fkey FOREIGN KEY (user2_id) REFERENCES users(id) ON DELETE SET NULL,
+    ADD CONSTRAINT chat_sessions_ended_by_fkey FOREIGN KEY (ended_by) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE messages
+    ALTER COLUMN sender_id DROP NOT NULL,
+    DROP CONSTRAINT messages_sender_id_fkey,
+    ADD CONSTRAINT messages_sender_id_fkey FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE SET NULL;
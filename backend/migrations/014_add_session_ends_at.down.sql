@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_timezone;
+ALTER TABLE users ALTER COLUMN timezone DROP NOT NULL;
+DROP INDEX IF EXISTS idx_chat_sessions_ends_at;
+ALTER TABLE chat_sessions DROP COLUMN IF EXISTS ends_at;
@@ -0,0 +1,15 @@
+-- Sessions end at midnight in the timezone of the cohort they were matched in
+ALTER TABLE chat_sessions ADD COLUMN ends_at TIMESTAMPTZ;
+
+UPDATE chat_sessions SET ends_at = date_trunc('day', started_at) + INTERVAL '1 day';
+
+CREATE INDEX idx_chat_sessions_ends_at ON chat_sessions(ends_at) WHERE status = 'active';
+
+-- Matching queries compute local days with AT TIME ZONE, which fails on
+-- names Postgres does not know
+UPDATE users SET timezone = 'UTC'
+WHERE timezone IS NULL OR timezone NOT IN (SELECT name FROM pg_timezone_names);
+
+ALTER TABLE users ALTER COLUMN timezone SET NOT NULL;
+
+CREATE INDEX idx_users_timezone ON users(timezone);
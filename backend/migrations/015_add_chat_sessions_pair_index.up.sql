@@ -0,0 +1,3 @@
+-- Looks up whether two users have been matched before regardless of which
+-- of them was user1
+CREATE INDEX idx_chat_sessions_pair ON chat_sessions (LEAST(user1_id, user2_id), GREATEST(user1_id, user2_id), started_at);
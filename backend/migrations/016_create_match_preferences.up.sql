@@ -0,0 +1,8 @@
+CREATE TABLE match_preferences (
+    user_id                     UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    min_age                     INTEGER,
+    max_age                     INTEGER,
+    max_distance_km             DOUBLE PRECISION,
+    require_looking_for_overlap BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at                  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
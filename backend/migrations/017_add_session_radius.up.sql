@@ -0,0 +1 @@
+ALTER TABLE chat_sessions ADD COLUMN radius_km DOUBLE PRECISION;
@@ -0,0 +1,18 @@
+-- One row per user per local day they were matched. The primary key is what
+-- stops two concurrent match attempts from giving a user two sessions a day.
+CREATE TABLE daily_matches (
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    match_date DATE NOT NULL,
+    session_id UUID NOT NULL REFERENCES chat_sessions(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, match_date)
+);
+
+CREATE INDEX idx_daily_matches_session ON daily_matches(session_id);
+
+INSERT INTO daily_matches (user_id, match_date, session_id, created_at)
+SELECT u.id, (cs.started_at AT TIME ZONE u.timezone)::date, cs.id, cs.started_at
+FROM chat_sessions cs
+JOIN users u ON u.id IN (cs.user1_id, cs.user2_id)
+ORDER BY cs.started_at
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS feedback_scores;
+DROP TABLE IF EXISTS session_feedback;
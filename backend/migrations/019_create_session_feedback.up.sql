@@ -0,0 +1,21 @@
+CREATE TABLE session_feedback (
+    session_id       UUID NOT NULL REFERENCES chat_sessions(id) ON DELETE CASCADE,
+    from_user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating           SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    tags             JSONB NOT NULL DEFAULT '[]',
+    would_chat_again BOOLEAN NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (session_id, from_user_id)
+);
+
+CREATE INDEX idx_session_feedback_to_user ON session_feedback(to_user_id);
+
+-- How well a user's chats are received by their partners, from 0 to 1
+CREATE TABLE feedback_scores (
+    user_id        UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    reception      DOUBLE PRECISION NOT NULL DEFAULT 0.5,
+    feedback_count INTEGER NOT NULL DEFAULT 0,
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,19 @@
+ALTER TABLE chat_sessions
+    DROP COLUMN IF EXISTS user1_connect_at,
+    DROP COLUMN IF EXISTS user2_connect_at,
+    DROP COLUMN IF EXISTS connected_at;
+
+-- Postgres cannot drop an enum value, so rebuild the type without it
+UPDATE chat_sessions SET status = 'ended_by_system', ended_at = COALESCE(ended_at, NOW())
+WHERE status = 'connected';
+
+DROP INDEX IF EXISTS idx_chat_sessions_status;
+DROP INDEX IF EXISTS idx_chat_sessions_ends_at;
+ALTER TABLE chat_sessions ALTER COLUMN status DROP DEFAULT;
+ALTER TYPE chat_status RENAME TO chat_status_old;
+CREATE TYPE chat_status AS ENUM ('active', 'ended_by_user', 'ended_by_system', 'ended_no_reply');
+ALTER TABLE chat_sessions ALTER COLUMN status TYPE chat_status USING status::text::chat_status;
+ALTER TABLE chat_sessions ALTER COLUMN status SET DEFAULT 'active';
+DROP TYPE chat_status_old;
+CREATE INDEX idx_chat_sessions_status ON chat_sessions(status) WHERE status = 'active';
+CREATE INDEX idx_chat_sessions_ends_at ON chat_sessions(ends_at) WHERE status = 'active';
@@ -0,0 +1,8 @@
+-- A session both users chose to keep becomes a connection that outlives its
+-- nightly window
+ALTER TYPE chat_status ADD VALUE IF NOT EXISTS 'connected';
+
+ALTER TABLE chat_sessions
+    ADD COLUMN user1_connect_at TIMESTAMPTZ,
+    ADD COLUMN user2_connect_at TIMESTAMPTZ,
+    ADD COLUMN connected_at     TIMESTAMPTZ;
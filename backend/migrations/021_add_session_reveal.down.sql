@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_chat_sessions_unannounced;
+ALTER TABLE chat_sessions
+    DROP COLUMN IF EXISTS reveal_at,
+    DROP COLUMN IF EXISTS announced_at;
@@ -0,0 +1,9 @@
+-- Batch matches can be hidden until a cohort-wide reveal time; announced_at
+-- records when both users were told about the match
+ALTER TABLE chat_sessions
+    ADD COLUMN reveal_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN announced_at TIMESTAMPTZ;
+
+UPDATE chat_sessions SET reveal_at = started_at, announced_at = started_at;
+
+CREATE INDEX idx_chat_sessions_unannounced ON chat_sessions(reveal_at) WHERE announced_at IS NULL;
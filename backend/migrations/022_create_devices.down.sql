@@ -0,0 +1,2 @@
+ALTER TABLE chat_sessions DROP COLUMN IF EXISTS closing_notified_at;
+DROP TABLE IF EXISTS devices;
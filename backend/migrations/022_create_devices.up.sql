@@ -0,0 +1,14 @@
+CREATE TABLE devices (
+    id           UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider     VARCHAR(10) NOT NULL CHECK (provider IN ('expo', 'apns', 'fcm')),
+    token        TEXT NOT NULL UNIQUE,
+    platform     VARCHAR(10),
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_devices_user ON devices(user_id);
+
+-- When users were warned that their session's window is about to close
+ALTER TABLE chat_sessions ADD COLUMN closing_notified_at TIMESTAMPTZ;
@@ -0,0 +1,21 @@
+DROP INDEX IF EXISTS idx_chat_sessions_ended_by;
+
+-- Postgres cannot drop an enum value, so rebuild both types without them
+UPDATE chat_sessions SET status = 'ended_by_user' WHERE status = 'skipped';
+DELETE FROM behavior_events WHERE event_type = 'skip';
+
+DROP INDEX IF EXISTS idx_chat_sessions_status;
+DROP INDEX IF EXISTS idx_chat_sessions_ends_at;
+ALTER TABLE chat_sessions ALTER COLUMN status DROP DEFAULT;
+ALTER TYPE chat_status RENAME TO chat_status_old;
+CREATE TYPE chat_status AS ENUM ('active', 'ended_by_user', 'ended_by_system', 'ended_no_reply', 'connected');
+ALTER TABLE chat_sessions ALTER COLUMN status TYPE chat_status USING status::text::chat_status;
+ALTER TABLE chat_sessions ALTER COLUMN status SET DEFAULT 'active';
+DROP TYPE chat_status_old;
+CREATE INDEX idx_chat_sessions_status ON chat_sessions(status) WHERE status = 'active';
+CREATE INDEX idx_chat_sessions_ends_at ON chat_sessions(ends_at) WHERE status = 'active';
+
+ALTER TYPE event_type RENAME TO event_type_old;
+CREATE TYPE event_type AS ENUM ('reply', 'no_reply', 'end_chat', 'delay');
+ALTER TABLE behavior_events ALTER COLUMN event_type TYPE event_type USING event_type::text::event_type;
+DROP TYPE event_type_old;
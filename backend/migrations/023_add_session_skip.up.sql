@@ -0,0 +1,6 @@
+-- A user can skip tonight's match. The session ends as skipped with ended_by
+-- set to the user who skipped, and the skip is a behavior event of its own
+ALTER TYPE chat_status ADD VALUE IF NOT EXISTS 'skipped';
+ALTER TYPE event_type ADD VALUE IF NOT EXISTS 'skip';
+
+CREATE INDEX idx_chat_sessions_ended_by ON chat_sessions(ended_by, ended_at);
@@ -0,0 +1,5 @@
+-- Connections are not ended at midnight, so record when their night was
+-- scored instead
+ALTER TABLE chat_sessions ADD COLUMN scored_at TIMESTAMPTZ;
+
+UPDATE chat_sessions SET scored_at = NOW() WHERE status = 'connected' AND ends_at <= NOW();
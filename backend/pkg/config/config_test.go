@@ -0,0 +1,55 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadRefusesUnparsableValues(t *testing.T) {
+	tests := []struct {
+		key, value string
+	}{
+		{"JWT_ACCESS_TTL", "15 minutes"},
+		{"LOGIN_MAX_FAILURES", "ten"},
+		{"MATCH_SKIPS_PER_DAY", "-1"},
+		{"MATCH_REMATCH_COOLDOWN", "7d"},
+		{"MATCH_RADIUS_STEPS_KM", "100,50"},
+		{"MATCH_RADIUS_STEPS_KM", "50,abc"},
+		{"MATCH_RADIUS_STEPS_KM", "0,50"},
+		{"MATCH_WEIGHTS", "proximity:0.5"},
+		{"MATCH_WEIGHTS", "proximity=-1"},
+		{"MATCH_TRAIT_WEIGHTS", "=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			t.Setenv("APP_ENV", "development")
+			t.Setenv(tt.key, tt.value)
+			err := Load().Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("Validate = %v, want an error naming %s", err, tt.key)
+			}
+		})
+	}
+}
+
+func TestLoadParsesValues(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("MATCH_REMATCH_COOLDOWN", "7")
+	t.Setenv("MATCH_RADIUS_STEPS_KM", "25, 75,200")
+	t.Setenv("MATCH_WEIGHTS", "jitter=0, proximity = 0.5,")
+
+	c := Load()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if c.MatchRematchCooldownDays != 7 {
+		t.Errorf("MatchRematchCooldownDays = %d, want 7", c.MatchRematchCooldownDays)
+	}
+	if got := c.MatchRadiusStepsKm; len(got) != 3 || got[0] != 25 || got[1] != 75 || got[2] != 200 {
+		t.Errorf("MatchRadiusStepsKm = %v, want [25 75 200]", got)
+	}
+	if w := c.MatchWeights; len(w) != 2 || w["jitter"] != 0 || w["proximity"] != 0.5 {
+		t.Errorf("MatchWeights = %v, want jitter=0 and proximity=0.5", w)
+	}
+}
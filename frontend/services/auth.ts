@@ -31,3 +31,11 @@ export async function refresh(refreshToken: string): Promise<TokenPair> {
   });
   return data;
 }
+
+export async function logout(refreshToken: string | null): Promise<void> {
+  await api.post("/auth/logout", { refresh_token: refreshToken ?? "" });
+}
+
+export async function logoutAll(): Promise<void> {
+  await api.post("/auth/logout-all");
+}
@@ -1,5 +1,5 @@
 import api from "./api";
-import type { ChatMessage } from "../types";
+import type { ChatFeedback, ChatMessage, Connection } from "../types";
 
 export async function getMessages(sessionId: string): Promise<ChatMessage[]> {
   const { data } = await api.get<ChatMessage[]>(
@@ -11,3 +11,28 @@ export async function getMessages(sessionId: string): Promise<ChatMessage[]> {
 export async function endChat(sessionId: string): Promise<void> {
   await api.post(`/chat/${sessionId}/end`);
 }
+
+export async function connect(
+  sessionId: string
+): Promise<{ status: "pending" | "connected" }> {
+  const { data } = await api.post<{ status: "pending" | "connected" }>(
+    `/chat/${sessionId}/connect`
+  );
+  return data;
+}
+
+export async function getConnections(): Promise<Connection[]> {
+  const { data } = await api.get<Connection[]>("/chat/connections");
+  return data;
+}
+
+export async function submitFeedback(
+  sessionId: string,
+  feedback: ChatFeedback
+): Promise<ChatFeedback> {
+  const { data } = await api.post<ChatFeedback>(
+    `/chat/${sessionId}/feedback`,
+    feedback
+  );
+  return data;
+}
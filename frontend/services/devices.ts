@@ -0,0 +1,10 @@
+import api from "./api";
+import type { DeviceRegistration } from "../types";
+
+export async function registerDevice(device: DeviceRegistration): Promise<void> {
+  await api.post("/devices", device);
+}
+
+export async function unregisterDevice(token: string): Promise<void> {
+  await api.delete(`/devices/${encodeURIComponent(token)}`);
+}
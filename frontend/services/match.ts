@@ -1,5 +1,10 @@
 import api from "./api";
-import type { MatchResponse } from "../types";
+import type {
+  MatchPreferences,
+  MatchResponse,
+  OptInResponse,
+  SkipResponse,
+} from "../types";
 
 export async function getTodayMatch(): Promise<MatchResponse> {
   const { data } = await api.get<MatchResponse>("/match/today");
@@ -10,3 +15,30 @@ export async function findMatch(): Promise<MatchResponse> {
   const { data } = await api.post<MatchResponse>("/match/find");
   return data;
 }
+
+export async function skipMatch(rematch = false): Promise<SkipResponse> {
+  const { data } = await api.post<SkipResponse>("/match/skip", { rematch });
+  return data;
+}
+
+export async function optIn(): Promise<OptInResponse> {
+  const { data } = await api.post<OptInResponse>("/match/optin");
+  return data;
+}
+
+export async function optOut(): Promise<OptInResponse> {
+  const { data } = await api.delete<OptInResponse>("/match/optin");
+  return data;
+}
+
+export async function getPreferences(): Promise<MatchPreferences> {
+  const { data } = await api.get<MatchPreferences>("/match/preferences");
+  return data;
+}
+
+export async function updatePreferences(
+  prefs: MatchPreferences
+): Promise<MatchPreferences> {
+  const { data } = await api.put<MatchPreferences>("/match/preferences", prefs);
+  return data;
+}
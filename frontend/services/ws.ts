@@ -1,4 +1,4 @@
-import * as storage from "./storage";
+import api from "./api";
 import type { WSMessage } from "../types";
 
 const WS_URL = process.env.EXPO_PUBLIC_WS_URL || "ws://localhost:8080";
@@ -7,21 +7,24 @@ type MessageHandler = (msg: WSMessage) => void;
 
 export class ChatWebSocket {
   private ws: WebSocket | null = null;
-  private sessionId: string;
+  private sessionId?: string;
   private handlers: MessageHandler[] = [];
   private reconnectAttempts = 0;
   private maxReconnect = 5;
   private reconnectTimer: ReturnType<typeof setTimeout> | null = null;
 
-  constructor(sessionId: string) {
+  // Without a session the socket only receives the user's events, such as
+  // match_created.
+  constructor(sessionId?: string) {
     this.sessionId = sessionId;
   }
 
   async connect(): Promise<void> {
-    const token = await storage.getItem("access_token");
-    if (!token) throw new Error("Not authenticated");
+    // Tickets are single-use, so fetch a fresh one on every (re)connect.
+    const { data } = await api.post<{ ticket: string }>("/chat/ws-ticket");
 
-    const url = `${WS_URL}/api/chat/ws?session_id=${this.sessionId}&token=${token}`;
+    const session = this.sessionId ? `session_id=${this.sessionId}&` : "";
+    const url = `${WS_URL}/api/chat/ws?${session}ticket=${data.ticket}`;
     this.ws = new WebSocket(url);
 
     this.ws.onopen = () => {
@@ -62,7 +65,7 @@ export class ChatWebSocket {
   sendMessage(content: string): void {
     this.send({
       type: "message",
-      session_id: this.sessionId,
+      session_id: this.sessionId ?? "",
       content,
     });
   }
@@ -70,7 +73,7 @@ export class ChatWebSocket {
   sendTyping(): void {
     this.send({
       type: "typing",
-      session_id: this.sessionId,
+      session_id: this.sessionId ?? "",
     });
   }
 
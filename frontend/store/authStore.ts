@@ -59,6 +59,12 @@ export const useAuthStore = create<AuthState>((set) => ({
   },
 
   logout: async () => {
+    try {
+      const refreshToken = await storage.getItem("refresh_token");
+      await authService.logout(refreshToken);
+    } catch {
+      // tokens are dropped locally either way
+    }
     await storage.deleteItem("access_token");
     await storage.deleteItem("refresh_token");
     set({ user: null, isAuthenticated: false });
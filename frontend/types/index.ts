@@ -1,6 +1,7 @@
 export interface User {
   id: string;
   email: string;
+  email_verified: boolean;
   username: string;
   photo_url: string | null;
   interests: string[];
@@ -16,21 +17,68 @@ export interface TokenPair {
   refresh_token: string;
 }
 
+export interface MFAChallenge {
+  mfa_required: true;
+  mfa_token: string;
+}
+
 export interface MatchResult {
   session_id: string;
-  status: "active" | "ended_by_user" | "ended_by_system" | "ended_no_reply";
+  status:
+    | "active"
+    | "connected"
+    | "ended_by_user"
+    | "ended_by_system"
+    | "ended_no_reply";
   partner_id: string;
   partner_username: string;
   partner_photo: string | null;
   started_at: string;
+  reveal_at: string;
 }
 
 export interface MatchResponse {
   matched: boolean;
   match?: MatchResult;
+  pending?: boolean;
+  reveal_at?: string;
   message?: string;
 }
 
+export interface SkipResponse extends MatchResponse {
+  skipped: boolean;
+  session_id: string;
+  skips_left: number;
+}
+
+export interface OptInResponse {
+  opted_in: boolean;
+  expires_at?: string;
+}
+
+export interface MatchPreferences {
+  min_age: number | null;
+  max_age: number | null;
+  max_distance_km: number | null;
+  require_looking_for_overlap: boolean;
+}
+
+export type FeedbackTag =
+  | "great_conversation"
+  | "funny"
+  | "kind"
+  | "shared_interests"
+  | "boring"
+  | "rude"
+  | "unresponsive"
+  | "inappropriate";
+
+export interface ChatFeedback {
+  rating: number;
+  tags: FeedbackTag[];
+  would_chat_again: boolean;
+}
+
 export interface ChatMessage {
   id: string;
   session_id: string;
@@ -39,8 +87,33 @@ export interface ChatMessage {
   created_at: string;
 }
 
+export interface Connection {
+  session_id: string;
+  partner_id: string;
+  partner_username: string;
+  partner_photo: string | null;
+  connected_at: string;
+}
+
+export type PushProvider = "expo";
+
+export interface DeviceRegistration {
+  token: string;
+  provider: PushProvider;
+  platform?: "ios" | "android";
+}
+
 export interface WSMessage {
-  type: "message" | "typing" | "read_receipt" | "chat_ended";
+  type:
+    | "message"
+    | "typing"
+    | "read_receipt"
+    | "chat_ended"
+    | "connect_requested"
+    | "connected"
+    | "match_created"
+    | "window_closing"
+    | "match_skipped";
   session_id: string;
   content?: string;
   sender_id?: string;